@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -11,8 +12,12 @@ import (
 	"banjo.dev/trackerr/internal/database"
 	"banjo.dev/trackerr/internal/model"
 	"banjo.dev/trackerr/internal/protocols"
-	"banjo.dev/trackerr/internal/protocols/gt06"
+	_ "banjo.dev/trackerr/internal/protocols/gt06"
+	_ "banjo.dev/trackerr/internal/protocols/h02"
 	"banjo.dev/trackerr/internal/protocols/jt808"
+	_ "banjo.dev/trackerr/internal/protocols/queclink"
+	_ "banjo.dev/trackerr/internal/protocols/teltonika"
+	_ "banjo.dev/trackerr/internal/protocols/tk103"
 	"banjo.dev/trackerr/internal/utils"
 	"github.com/joho/godotenv"
 )
@@ -38,6 +43,7 @@ func main() {
 	API_PORT := os.Getenv("API_PORT")
 	API_CERT := os.Getenv("API_CERT")
 	API_CERTKEY := os.Getenv("API_CERTKEY")
+	jt808.VerifyModel = os.Getenv("JT808_VERIFY_MODEL") == "true"
 
 	// Include time when using log.print
 	log.SetFlags(log.LstdFlags)
@@ -49,6 +55,12 @@ func main() {
 	// with actual ip and <port> with actual port
 	submap := map[string]string{"<ip>": SERVER_IP, "<port>": TRACKERCOM_PORT}
 	database.SetCommandSubstituation(submap)
+	database.SetMediaDir(os.Getenv("MEDIA_DIR"))
+	database.SetFirmwareDir(os.Getenv("FIRMWARE_DIR"))
+	// Upgrades being sent when the server stopped can not be resumed
+	if err := database.FailInterruptedFirmwareUpgrades(time.Now().Unix()); err != nil {
+		log.Println(err)
+	}
 	// Create trackerManager
 	trackerManager := &model.TrackerManager{
 		Handlers:     make(map[string]*model.TrackerHandler),
@@ -67,6 +79,10 @@ func commandHandler(tm *model.TrackerManager) {
 		cmd := <-tm.CommandQueue
 		handler, ok := tm.Handlers[cmd.TrackerId]
 		if !ok {
+			if cmd.Result != nil {
+				cmd.Result <- model.CommandResult{Err: fmt.Errorf("tracker is not connected")}
+				continue
+			}
 			cmd.Response <- "Failed to run command, since tracker is not connected"
 			continue
 		}
@@ -79,10 +95,13 @@ func eventHandler(events chan model.Locationdata) {
 	for {
 		tle := <-events
 		log.Printf("Event: %v\n", tle)
+		// Fall back to receive time if device did not report a GPS time
+		if tle.Timestamp == 0 {
+			tle.Timestamp = tle.ReceivedAt
+		}
 		if tle.Lat == 0 && tle.Lon == 0 {
 			log.Printf("Received location event with empty coordinates\n")
-			return
-
+			continue
 		}
 		if err := database.InsertLocationRecord(tle); err != nil {
 			log.Printf("EventHandler: Error: %v\n", err)
@@ -121,7 +140,7 @@ func tcpserver(TRACKERCOM_PORT string, tm *model.TrackerManager) {
 
 func handleTracker(tm *model.TrackerManager, conn net.Conn) {
 	// Authenticate tracker
-	trackerId, protocol, err := protocols.PerformAuth(conn)
+	trackerId, protocol, version, first, err := protocols.PerformAuth(conn)
 	if err != nil {
 		log.Println("Handshake failed: ", err)
 		conn.Close()
@@ -135,12 +154,14 @@ func handleTracker(tm *model.TrackerManager, conn net.Conn) {
 	}
 	// Create trackerHandler
 	handler := &model.TrackerHandler{
-		Id:           trackerId,
-		Conn:         conn,
-		CommandQueue: make(chan model.TrackerCommand, 10),
-		EventHandler: tm.EventHandler,
-		SerialNumber: 1,
-		DoneFlag:     make(chan bool),
+		Id:              trackerId,
+		Protocol:        protocol.Type(),
+		ProtocolVersion: version,
+		Conn:            conn,
+		CommandQueue:    make(chan model.TrackerCommand, 10),
+		EventHandler:    tm.EventHandler,
+		SerialNumber:    1,
+		DoneFlag:        make(chan bool),
 	}
 
 	// Store trackerHandler in trackerManager
@@ -153,13 +174,7 @@ func handleTracker(tm *model.TrackerManager, conn net.Conn) {
 	tm.Handlers[trackerId] = handler
 	tm.Mu.Unlock()
 	database.UpdateLastConnected(trackerId, time.Now().UTC().Unix())
-	// Pass connection to protocol specific handler
-	switch protocol {
-	case utils.ProtocolTypeJT808:
-		handleJT808Connection(handler)
-	case utils.ProtocolTypeGT06:
-		handleGT06Connection(handler)
-	}
+	handleConnection(handler, protocol, first)
 	// Remove from handler if still in trackerManager.
 	// If it's killed by the done flag, is likely overwritten in tm.Handlers and therefore should NOT  be removed.
 	tm.Mu.Lock()
@@ -170,14 +185,30 @@ func handleTracker(tm *model.TrackerManager, conn net.Conn) {
 	log.Printf("Remvoved handler for %v\n", trackerId)
 }
 
-func handleGT06Connection(t *model.TrackerHandler) {
+// Handle connection of an authenticated tracker, using the session of its protocol
+// first is the message the tracker was authenticated with
+func handleConnection(t *model.TrackerHandler, protocol protocols.Protocol, first model.Packet) {
 	defer log.Printf("%v: Connection has been closed\n", t.Id)
 	defer t.Conn.Close()
+	log.Printf("%v: Device has conencted using %v protocol version %v!\n", t.Id, protocol.Name(), t.ProtocolVersion)
 
-	log.Printf("%v: Device has conencted!\n", t.Id)
-	resChannelMap := make(map[uint32]chan string)
-	heartbeatTimer := time.NewTimer(gt06.HeartbeatInterval + time.Minute)
+	session := protocol.NewSession(t)
+	// Response channels of sent commands waiting for a response, in the order they were sent
+	pending := make([]pendingCmd, 0)
+	heartbeatTimer := time.NewTimer(protocol.HeartbeatInterval() + time.Minute)
 	defer heartbeatTimer.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	// Decode first message of trackers without a login message
+	if l, ok := protocol.(protocols.Loginless); ok && l.DecodeFirst(first) {
+		events, err := session.Decode(first)
+		for _, e := range events {
+			pending = handleEvent(t, e, pending)
+		}
+		if err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	}
 
 	for {
 		select {
@@ -189,110 +220,28 @@ func handleGT06Connection(t *model.TrackerHandler) {
 		case <-heartbeatTimer.C:
 			log.Printf("%v: Closing connection since heartbeat was not received\n", t.Id)
 			return
+		// Retransmit or time out messages
+		case now := <-ticker.C:
+			session.Tick(now)
 		// If command in queue, send it
 		case cmd := <-t.CommandQueue:
-			gt06.SendCmd(t.Conn, cmd.Payload, t.SerialNumber, uint32(t.SerialNumber))
-			resChannelMap[uint32(t.SerialNumber)] = cmd.Response
-			t.SerialNumber++
-			log.Printf("%v: Sent: %v\n", t.Id, cmd)
-		default:
-			// Read and parse packet, using a 1s deadline
-			p, _, err := protocols.ParseMsg(t.Conn, 1*time.Second)
-
-			if err != nil {
-				// Continue if there is no packet to read
-				if err, ok := err.(net.Error); ok && err.Timeout() {
-					continue
+			// Send protocol specific message
+			if cmd.MsgType != 0 {
+				if err := session.SendMessage(cmd); err != nil {
+					cmd.Result <- model.CommandResult{Err: err}
 				}
-				// Stop handler if tracker want to end connection
-				if err == io.EOF {
-					return
-				}
-				log.Printf("%v: Failed to parse packet:%v\n", err, t.Id)
 				continue
 			}
-			switch uint8(p.PacketType) {
-			// Location update
-			case gt06.MsgTypeLocation, gt06.MsgTypeLocation4g:
-				ld := gt06.ParseLocationMsg(p.Payload)
-				ld.TrackerId = t.Id
-				ld.Timestamp = time.Now().Unix()
-				log.Printf("%v: Position: %v\n", t.Id, utils.StringifyCoordinates(ld.Lat, ld.Lon))
-				t.EventHandler <- ld
-			// Heartbeat
-			case gt06.MsgTypeHeartbeat:
-				log.Printf("%v: Received heartbeat\n", t.Id)
-				// Reset heartbeat timer
-				heartbeatTimer.Reset(gt06.HeartbeatInterval + time.Minute)
-				// Potential to implement parser for terminal info, voltage level, gsm signal strength, external voltage and language
-				gt06.SendMsg(t.Conn, false, gt06.MsgTypeHeartbeat, []byte{}, p.SerialNumber)
-			// Server cmd response
-			case gt06.MsgTypeCmdResponse:
-				r, id := gt06.ParseCmdRes(p.Payload)
-				log.Printf("%v: Server Response:%v\n", t.Id, r)
-
-				// Find corresponding response channel in map
-				rChannel, ok := resChannelMap[uint32(id)]
-				// Check if it was found
-				if !ok {
-					log.Printf("%v: Received response but response queue was empty\n", t.Id)
-					continue
-				}
-				// Send the reponse to it, if it was found
-				rChannel <- r
-				// Remove from map when it has sent the response
-				delete(resChannelMap, uint32(id))
-			// Alarm
-			case gt06.MsgTypeAlarm:
-				ld, alarm := gt06.ParseAlarmMsg(p.Payload)
-				log.Printf("%v: Received %v alarm\n", t.Id, alarm)
-				log.Printf("%v: Position: %v\n", t.Id, utils.StringifyCoordinates(ld.Lat, ld.Lon))
-				ld.TrackerId = t.Id
-				t.EventHandler <- ld
-			// IMSI
-			case gt06.MsgTypeIMSI:
-				log.Printf("%v: Terminal sending IMSI number\n", t.Id)
-			// ICCID
-			case gt06.MsgTypeICCID:
-				log.Printf("%v: Terminal sending ICCID number\n", t.Id)
-			// Unknown
-			default:
-				log.Printf("%v: Unknown protocol number: %x\nPayload:%v", t.Id, p.PacketType, p.Payload)
+			id, err := session.SendCommand(cmd.Payload)
+			if err != nil {
+				cmd.Response <- fmt.Sprintf("Failed to send command: %v", err)
+				continue
 			}
-		}
-	}
-}
-
-func handleJT808Connection(t *model.TrackerHandler) {
-	defer log.Printf("%v: Connection has been closed\n", t.Id)
-	defer t.Conn.Close()
-	log.Printf("%v: Device has conencted!\n", t.Id)
-
-	resChannelQueue := make([]chan string, 0)
-	heartbeatTimer := time.NewTimer(jt808.HeartbeatInterval + time.Minute)
-	defer heartbeatTimer.Stop()
-
-	for {
-		select {
-		// If done flag set, kill connection
-		case <-t.DoneFlag:
-			log.Printf("%v: Closing connection since Done flag is set\n", t.Id)
-			return
-		// Close connection if heartbeat not received in timely manner
-		case <-heartbeatTimer.C:
-			log.Printf("%v: Closing connection since heartbeat was not received\n", t.Id)
-			return
-
-		// If command in queue, send it
-		case cmd := <-t.CommandQueue:
-			jt808.SendCmd(t.Conn, cmd.Payload, t.Id, t.SerialNumber)
-			t.SerialNumber++
 			log.Printf("%v: Sent: %v\n", t.Id, cmd)
-			// Add response channel to queue
-			resChannelQueue = append(resChannelQueue, cmd.Response)
-
+			pending = append(pending, pendingCmd{id: id, response: cmd.Response})
 		default:
-			p, _, err := protocols.ParseMsg(t.Conn, 1*time.Second)
+			// Read and parse packet, using a 1s deadline
+			p, msgProtocol, err := protocols.ParseMsg(t.Conn, 1*time.Second)
 			if err != nil {
 				// No TCP packet in buffer
 				if err, ok := err.(net.Error); ok && err.Timeout() {
@@ -302,56 +251,83 @@ func handleJT808Connection(t *model.TrackerHandler) {
 				if err == io.EOF {
 					return
 				}
-				log.Println("Failed to parse packet:", err)
+				log.Printf("%v: Failed to parse packet: %v\n", t.Id, err)
 				continue
 			}
-			switch p.PacketType {
-
-			case jt808.MsgTypeTermUniversalRes: // Universal terinal response - ignore
+			if msgProtocol.Type() != protocol.Type() {
+				log.Printf("%v: Ignoring %v message\n", t.Id, msgProtocol.Name())
 				continue
-			case jt808.MsgTypeHeartbeat: // Heartbeat
-				log.Println("Recevied heartbeat")
-				// Reset heartbeat timer
-				heartbeatTimer.Reset(jt808.HeartbeatInterval + time.Minute)
-				jt808.SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, jt808.ResultSuccess, t.Id)
-			case jt808.MsgTypeLogout: // log out
-				if err := database.RemoveAuthCode(t.Id); err != nil {
-					log.Println(err)
+			}
+			events, err := session.Decode(p)
+			// Handle the events which were decoded, even if decoding failed
+			for _, e := range events {
+				pending = handleEvent(t, e, pending)
+				if e.Heartbeat {
+					// Reset heartbeat timer
+					heartbeatTimer.Reset(protocol.HeartbeatInterval() + time.Minute)
 				}
+			}
+			if err == protocols.ErrLoggedOut {
 				return
-			case jt808.MsgTypeLocation: // Position info report
-				log.Println("Recevied position info")
-				jt808.SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, jt808.ResultSuccess, t.Id)
-				ld := jt808.ParseLocationMsg(p.Payload)
-				utils.StdLatLon(&ld, jt808.CoordinatePrecision)
-				log.Printf("%v: Position: %v\n", t.Id, utils.StringifyCoordinates(ld.Lat, ld.Lon))
-				ld.TrackerId = t.Id
-				ld.Timestamp = time.Now().Unix()
-				t.EventHandler <- ld
-			case jt808.MsgTypeVersionInfo: // Version info packet
-				log.Println("Recevied version info")
-				payload := append(jt808.GetCNTimeAsBCD(), []byte{0, 0, 0, 0, 0}...)
-				log.Println("Chinese time:", payload)
-				jt808.SendMsg(t.Conn, jt808.MsgTypeVersionInfoRes, payload, p.SerialNumber, t.Id)
-			case jt808.MsgTypeLocationBatch: // Position info batch report --NOT IMPLEMENTED
-				jt808.SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, jt808.ResultSuccess, t.Id)
-			case jt808.MsgTypeUpstreamData: // Upstream data --NOT IMPLEMENTED
-				jt808.SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, jt808.ResultSuccess, t.Id)
-			case jt808.MsgTypeCmdRes: // Command Response
-				r := jt808.ParseCmdRes(p.Payload)
-				log.Printf("%v: Received command response: %v\n", t.Id, r)
-				// Check if response channel queue is empty
-				if len(resChannelQueue) == 0 {
-					log.Printf("%v: Received response but response queue was empty\n", t.Id)
-					continue
-				}
-				// Send response to first response channel in queue
-				resChannelQueue[0] <- r
-				// Pop the head
-				resChannelQueue = resChannelQueue[1:]
-			default:
-				log.Printf("%v: Unknown protocol number: %x\nPayload:%v", t.Id, p.PacketType, p.Payload)
 			}
+			if err != nil {
+				log.Printf("%v: Error: %v\n", t.Id, err)
+			}
+		}
+	}
+}
+
+// Command waiting for a response
+type pendingCmd struct {
+	id       uint32
+	response chan string
+}
+
+// Store event decoded from a message of tracker t
+// Returns the commands still waiting for a response
+func handleEvent(t *model.TrackerHandler, e protocols.Event, pending []pendingCmd) []pendingCmd {
+	if e.Alarm != nil {
+		log.Printf("%v: Received %v alarm\n", t.Id, e.Alarm.Name)
+		e.Alarm.TrackerId = t.Id
+		if err := database.InsertAlarm(*e.Alarm); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	}
+	if e.Location != nil {
+		log.Printf("%v: Position: %v\n", t.Id, utils.StringifyCoordinates(e.Location.Lat, e.Location.Lon))
+		e.Location.TrackerId = t.Id
+		e.Location.ReceivedAt = time.Now().Unix()
+		t.EventHandler <- *e.Location
+	}
+	if e.Status != nil {
+		e.Status.TrackerId = t.Id
+		if err := database.InsertTerminalStatus(*e.Status); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	}
+	if e.IMSI != "" {
+		log.Printf("%v: Terminal sending IMSI number: %v\n", t.Id, e.IMSI)
+		if err := database.UpdateIMSI(t.Id, e.IMSI); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	}
+	if e.ICCID != "" {
+		log.Printf("%v: Terminal sending ICCID number: %v\n", t.Id, e.ICCID)
+		if err := database.UpdateICCID(t.Id, e.ICCID); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	}
+	if e.CmdResponse != nil {
+		log.Printf("%v: Received command response: %v\n", t.Id, e.CmdResponse.Text)
+		// Find the command the response is for, or the oldest command if the response does not refer to it
+		for i, cmd := range pending {
+			if e.CmdResponse.HasId && cmd.id != e.CmdResponse.Id {
+				continue
+			}
+			cmd.response <- e.CmdResponse.Text
+			return append(pending[:i], pending[i+1:]...)
 		}
+		log.Printf("%v: Received response but response queue was empty\n", t.Id)
 	}
+	return pending
 }
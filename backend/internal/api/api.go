@@ -1,17 +1,24 @@
 package api
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"maps"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"time"
 
 	"banjo.dev/trackerr/internal/database"
 	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols/jt808"
+	"banjo.dev/trackerr/internal/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -46,16 +53,261 @@ type CommandReq struct {
 	Command string `json:"command" binding:"required,min=1"`
 }
 
+type ParametersReq struct {
+	HeartbeatInterval  *uint32 `json:"heartbeatInterval" binding:"omitempty,min=1"`
+	ReportInterval     *uint32 `json:"reportInterval" binding:"omitempty,min=1"`
+	ServerAddress      *string `json:"serverAddress" binding:"omitempty,min=1,max=255"`
+	ServerPort         *uint32 `json:"serverPort" binding:"omitempty,min=1,max=65535"`
+	APN                *string `json:"apn" binding:"omitempty,max=255"`
+	OverspeedThreshold *uint32 `json:"overspeedThreshold" binding:"omitempty,min=1,max=255"`
+}
+
+// Command is one of reboot, factoryReset, connectServer, closeDataLink and radioOff
+// Server is required for connectServer and TimeLimit is in minutes
+type TerminalControlReq struct {
+	Command string     `json:"command" binding:"required,oneof=reboot factoryReset connectServer closeDataLink radioOff"`
+	Server  *ServerReq `json:"server" binding:"required_if=Command connectServer,omitempty"`
+}
+
+type ServerReq struct {
+	Address   string `json:"address" binding:"required,min=1,max=255,excludes=;"`
+	TCPPort   uint16 `json:"tcpPort" binding:"required,min=1"`
+	UDPPort   uint16 `json:"udpPort"`
+	APN       string `json:"apn" binding:"max=255,excludes=;"`
+	Username  string `json:"username" binding:"max=255,excludes=;"`
+	Password  string `json:"password" binding:"max=255,excludes=;"`
+	AuthCode  string `json:"authCode" binding:"max=255,excludes=;"`
+	TimeLimit uint16 `json:"timeLimit"`
+}
+
+// Interval is in seconds and Duration in minutes
+type TrackingReq struct {
+	Interval uint16 `json:"interval" binding:"required,min=1"`
+	Duration uint32 `json:"duration" binding:"required,min=1,max=1440"`
+}
+
+// Coordinates use the same precision as LocationResponse
+// Points are the center of a circle, top-left and bottom-right corner of a rectangle, vertices of a polygon or inflection points of a route
+// Radius is required for circles and Width for routes, both in meters. MaxSpeed is in km/h and OverspeedDuration in seconds
+type RegionReq struct {
+	Name              string     `json:"name" binding:"required,min=1,max=32"`
+	Type              string     `json:"type" binding:"required,oneof=circle rectangle polygon route"`
+	Points            []PointReq `json:"points" binding:"required,min=1,max=125,dive"`
+	Radius            uint32     `json:"radius" binding:"required_if=Type circle"`
+	Width             uint8      `json:"width" binding:"required_if=Type route"`
+	MaxSpeed          *uint16    `json:"maxSpeed" binding:"omitempty,min=1"`
+	OverspeedDuration uint8      `json:"overspeedDuration"`
+	AlarmOnEnter      bool       `json:"alarmOnEnter"`
+	AlarmOnExit       bool       `json:"alarmOnExit"`
+}
+
+type PointReq struct {
+	Lat int32 `json:"lat" binding:"min=-180000000,max=180000000"`
+	Lon int32 `json:"lon" binding:"min=-360000000,max=360000000"`
+}
+
+type TrackerRegionReq struct {
+	RegionId int `json:"regionId" binding:"required,min=1"`
+}
+
+// Type is 0x41 for serial port 1, 0x42 for serial port 2 or 0xF0-0xFF for user defined types. Data is hex encoded
+type PassthroughReq struct {
+	Type uint8  `json:"type"`
+	Data string `json:"data" binding:"required,hexadecimal,max=2000"`
+}
+
+// Type is 0 for the terminal, 12 for the IC card reader and 52 for the GNSS module
+// ManufacturerId is truncated to 5 characters for JT808-2013 terminals
+type FirmwareReq struct {
+	File           *multipart.FileHeader `form:"file" binding:"required"`
+	Model          string                `form:"model" binding:"required,min=2"`
+	Version        string                `form:"version" binding:"required,min=1,max=255"`
+	Type           uint8                 `form:"type" binding:"oneof=0 12 52"`
+	ManufacturerId string                `form:"manufacturerId" binding:"max=11"`
+}
+
+type FirmwareUpgradeReq struct {
+	FirmwareId int `json:"firmwareId" binding:"required,min=1"`
+}
+
+// Count is the number of photos to take with Interval seconds between them
+// Resolution ranges from 1 (320x240) to 8 (704x576) and Quality from 1 (best) to 10
+// If Save is set, photos are stored on the tracker instead of being uploaded
+type SnapshotReq struct {
+	Channel    uint8  `json:"channel" binding:"required,min=1"`
+	Count      uint16 `json:"count" binding:"omitempty,min=1,max=65534"`
+	Interval   uint16 `json:"interval"`
+	Save       bool   `json:"save"`
+	Resolution uint8  `json:"resolution" binding:"omitempty,min=1,max=8"`
+	Quality    uint8  `json:"quality" binding:"omitempty,min=1,max=10"`
+}
+
 type EnableReq struct {
 	Enabled bool `json:"enabled"`
 }
 
+// Mileage is in 0.1 km, Fuel in 0.1 L and RecorderSpeed in 0.1 km/h. They are only set if reported by the tracker
 type LocationResponse struct {
-	Timestamp *string
-	Lat       *uint32
-	Lon       *uint32
-	Speed     *uint16
-	Heading   *uint16
+	Timestamp      *string
+	ReceivedAt     *string
+	Lat            *int32
+	Lon            *int32
+	Speed          *uint16
+	Heading        *uint16
+	Historic       *bool
+	Altitude       *uint16
+	AlarmFlags     *uint32
+	Status         *uint32
+	Mileage        *uint32
+	Fuel           *uint16
+	RecorderSpeed  *uint16
+	SignalStrength *uint8
+	Satellites     *uint8
+	DriverId       *int
+}
+
+// VoltageLevel ranges from 0 (no power) to 6 (very high), GSMSignal from 0 (no signal) to 4 (strong)
+// ExternalVoltage is in 0.01V and only set by devices reporting it instead of VoltageLevel
+type StatusResponse struct {
+	Timestamp       string
+	OilCut          bool
+	GPSTracking     bool
+	Alarm           uint8
+	Charging        bool
+	ACC             bool
+	Defense         bool
+	VoltageLevel    uint8
+	ExternalVoltage uint16
+	GSMSignal       uint8
+}
+
+// Details reported by a JT808 terminal when it last registered
+// ModelMatches indicates if TerminalModel matches the model the tracker is registered with
+type RegistrationResponse struct {
+	Timestamp      string
+	ProvinceId     uint16
+	CityId         uint16
+	ManufacturerId string
+	TerminalModel  string
+	TerminalId     string
+	PlateColour    uint8
+	PlateNumber    string
+	ModelMatches   bool
+}
+
+// Interval is in seconds. UserId is the user who started the session
+type TrackingSessionResponse struct {
+	UserId    int
+	StartedAt string
+	Interval  uint16
+	ExpiresAt string
+}
+
+// PushedAt is only set for regions held by a tracker
+type RegionResponse struct {
+	Id                int
+	Owner             int
+	Name              string
+	Type              string
+	Points            []model.Point
+	Radius            uint32
+	Width             uint8
+	MaxSpeed          *uint16
+	OverspeedDuration uint8
+	AlarmOnEnter      bool
+	AlarmOnExit       bool
+	PushedAt          *string
+}
+
+// Type is image, audio or video and Format is the file extension
+// Timestamp, Lat, Lon and AlarmFlags describe the position the media was captured at
+type MediaResponse struct {
+	Id         int
+	MediaId    uint32
+	Type       string
+	Format     string
+	Event      uint8
+	Channel    uint8
+	Timestamp  string
+	ReceivedAt string
+	Lat        int32
+	Lon        int32
+	AlarmFlags uint32
+	Size       int
+}
+
+// MediaIds are the ids of the media captured, which are uploaded unless saved on the tracker
+type SnapshotResponse struct {
+	MediaIds []uint32
+}
+
+// LastSeen is when a tracker last reported the IC card of the driver being inserted
+type DriverResponse struct {
+	Id                int
+	Name              string
+	Certificate       string
+	Agency            string
+	CertificateExpiry string
+	IdNumber          string
+	LastSeen          string
+}
+
+// Period the driver was logged in to a tracker. EndedAt is null while the driver is logged in
+type TripResponse struct {
+	Id        int
+	TrackerId string
+	StartedAt string
+	EndedAt   *string
+}
+
+type DriverLocationResponse struct {
+	TrackerId string
+	LocationResponse
+}
+
+// TypeName is gnss, icCard, serialPort1, serialPort2, userDefined or unknown. Data is hex encoded
+type PassthroughResponse struct {
+	Id        int
+	Timestamp string
+	Type      uint8
+	TypeName  string
+	Data      string
+}
+
+type FirmwareResponse struct {
+	Id             int
+	Model          string
+	Version        string
+	Type           uint8
+	ManufacturerId string
+	Size           int
+	UploadedAt     string
+}
+
+// Status is sending, sent, succeeded, failed or cancelled
+// SentPackages is the number of packages acknowledged by the tracker
+type FirmwareUpgradeResponse struct {
+	Id            int
+	FirmwareId    int
+	StartedAt     string
+	UpdatedAt     string
+	Status        string
+	SentPackages  int
+	TotalPackages int
+}
+
+// For JT808 trackers, Type is the bit number of the alarm flag
+// AcknowledgedBy is the id of the user who acknowledged the alarm, and is null with AcknowledgedAt until acknowledged
+type AlarmResponse struct {
+	Id             uint64
+	TrackerId      string
+	Timestamp      string
+	Type           uint16
+	Name           string
+	Lat            int32
+	Lon            int32
+	AcknowledgedBy *int
+	AcknowledgedAt *string
 }
 
 type TrackerResponse struct {
@@ -67,11 +319,21 @@ type TrackerResponse struct {
 	Connected     bool
 	Enabled       bool
 	LastConnected string
+	IMSI          string
+	ICCID         string
+	Status        *StatusResponse
+	Registration  *RegistrationResponse
 	LocationResponse
 }
 
 var tm *model.TrackerManager
 
+// Time to wait for a tracker to respond to a protocol specific message
+const commandTimeout = 30 * time.Second
+
+// Largest firmware file which fits in the maximum number of sub-packages
+const maxFirmwareSize int64 = 65535*int64(jt808.MaxSubPackageLength) - 1024
+
 func StartAPI(tmIn *model.TrackerManager, apiPort string, certPath string, certKeyPath string) {
 	tm = tmIn
 	// Set gin mode from environment variable GIN_MODE (loaded via .env in main).
@@ -108,12 +370,58 @@ func StartAPI(tmIn *model.TrackerManager, apiPort string, certPath string, certK
 				tracker.GET("", getTracker)
 				tracker.DELETE("", deregisterTracker)
 				tracker.POST("/command", sendCommand)
+				tracker.GET("/parameters", getParameters)
+				tracker.PUT("/parameters", setParameters)
+				tracker.POST("/control", controlTerminal)
+				tracker.GET("/tracking", getTracking)
+				tracker.POST("/tracking", startTracking)
+				tracker.DELETE("/tracking", stopTracking)
+				tracker.GET("/media", getTrackerMedia)
+				tracker.GET("/media/:mediaId", getTrackerMediaFile)
+				tracker.POST("/snapshot", takeSnapshot)
+				tracker.GET("/passthrough", getPassthroughData)
+				tracker.POST("/passthrough", sendPassthroughData)
+				tracker.GET("/firmware", AdminOnlyMiddleware(), getFirmwareUpgrades)
+				tracker.POST("/firmware", AdminOnlyMiddleware(), upgradeFirmware)
+				tracker.GET("/regions", getTrackerRegions)
+				tracker.POST("/regions", pushTrackerRegion)
+				tracker.DELETE("/regions/:regionId", RegionOwnershipMiddleware(), removeTrackerRegion)
 				tracker.GET("/location", getTrackerLocation)
 				tracker.GET("/locations", getTrackerLocations)
+				tracker.POST("/locate", locateTracker)
+				tracker.GET("/alarms", getTrackerAlarms)
+				tracker.POST("/alarms/:alarmId/acknowledge", acknowledgeAlarm)
+				tracker.GET("/status", getTrackerStatus)
+				tracker.GET("/statuses", getTrackerStatuses)
 				tracker.PUT("/enabled", setEnabled)
 			}
 		}
 
+		api.GET("/alarms", getAlarms)
+
+		drivers := api.Group("/drivers")
+		{
+			drivers.GET("", getDrivers)
+			drivers.GET("/:driverId", getDriver)
+			drivers.GET("/:driverId/trips", getDriverTrips)
+			drivers.GET("/:driverId/locations", getDriverLocations)
+		}
+
+		regions := api.Group("/regions")
+		{
+			regions.GET("", getRegions)
+			regions.POST("", createRegion)
+			regions.GET("/:regionId", RegionOwnershipMiddleware(), getRegion)
+			regions.DELETE("/:regionId", RegionOwnershipMiddleware(), deleteRegion)
+		}
+
+		firmware := api.Group("/firmware", AdminOnlyMiddleware())
+		{
+			firmware.GET("", getFirmware)
+			firmware.POST("", uploadFirmware)
+			firmware.DELETE("/:firmwareId", deleteFirmware)
+		}
+
 		models := api.Group("/models")
 		{
 			models.GET("", getModels)
@@ -177,6 +485,26 @@ func OwnershipMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Only allow request if specified region is owned by caller or if caller is admin
+// The region is stored in the context as "region"
+func RegionOwnershipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("regionId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"result": "invalid region id"})
+			c.Abort()
+			return
+		}
+		r, ok := getAccessibleRegion(c, id)
+		if !ok {
+			c.Abort()
+			return
+		}
+		c.Set("region", r)
+		c.Next()
+	}
+}
+
 // Only allow is the user is admin
 func AdminOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -203,13 +531,25 @@ func newTrackerResponse(ts []model.TrackerWithLocation) []TrackerResponse {
 		}
 		locationResp := LocationResponse{}
 		if t.Ld != nil {
-			timestamp := timeToString(t.Ld.Timestamp)
-			locationResp = LocationResponse{
-				Timestamp: &timestamp,
-				Lat:       &t.Ld.Lat,
-				Lon:       &t.Ld.Lon,
-				Speed:     &t.Ld.Speed,
-				Heading:   &t.Ld.Heading,
+			locationResp = newLocationResponse(t.Ld)
+		}
+		var statusResp *StatusResponse
+		if t.Status != nil {
+			sr := newStatusResponse(*t.Status)
+			statusResp = &sr
+		}
+		var registrationResp *RegistrationResponse
+		if t.Registration != nil {
+			registrationResp = &RegistrationResponse{
+				Timestamp:      timeToString(t.Registration.Timestamp),
+				ProvinceId:     t.Registration.ProvinceId,
+				CityId:         t.Registration.CityId,
+				ManufacturerId: t.Registration.ManufacturerId,
+				TerminalModel:  t.Registration.TerminalModel,
+				TerminalId:     t.Registration.TerminalId,
+				PlateColour:    t.Registration.PlateColour,
+				PlateNumber:    t.Registration.PlateNumber,
+				ModelMatches:   jt808.ModelMatches(*t.Registration, t.Model),
 			}
 		}
 		out = append(out, TrackerResponse{
@@ -221,6 +561,10 @@ func newTrackerResponse(ts []model.TrackerWithLocation) []TrackerResponse {
 			Connected:        connected,
 			Enabled:          t.Enabled,
 			LastConnected:    timeToString(t.LastConnected),
+			IMSI:             t.IMSI,
+			ICCID:            t.ICCID,
+			Status:           statusResp,
+			Registration:     registrationResp,
 			LocationResponse: locationResp,
 		})
 	}
@@ -228,9 +572,10 @@ func newTrackerResponse(ts []model.TrackerWithLocation) []TrackerResponse {
 }
 
 // @Summary      Get list of trackers
-// @Description  If the user is a admin, it will respond with a list of all trackers in the system, and if the user is a regular user, it will return all trackers owned by the user,
+// @Description  If the user is a admin, it will respond with a list of all trackers in the system, and if the user is a regular user, it will return all trackers owned by the user. The optional iccid parameter limits the list to the tracker with the specified SIM card
 // @Tags         Trackers
 // @Produce      json
+// @Param        iccid  query     string  false  "ICCID of SIM card"
 // @Success      200  {array}   TrackerResponse
 // @Failure      400  {object}  StringResultRes "API key required"
 // @Failure      401  {object}  StringResultRes "Invalid API key"
@@ -238,9 +583,15 @@ func newTrackerResponse(ts []model.TrackerWithLocation) []TrackerResponse {
 // @Security ApiKeyAuth
 func getTrackers(c *gin.Context) {
 	var trackers []model.TrackerWithLocation
-	if c.GetBool("isadmin") {
+	iccid := c.Query("iccid")
+	switch {
+	case iccid != "" && c.GetBool("isadmin"):
+		trackers = database.GetTrackersByICCID(iccid)
+	case iccid != "":
+		trackers = database.GetTrackersByUserAndICCID(c.GetInt("userId"), iccid)
+	case c.GetBool("isadmin"):
 		trackers = database.GetTrackers()
-	} else {
+	default:
 		trackers = database.GetTrackersByUserId(c.GetInt("userId"))
 	}
 	if trackers == nil {
@@ -424,7 +775,7 @@ func getModel(c *gin.Context) {
 }
 
 // @Summary      Create model
-// @Description  Add support for new model, by specifing which SMS messages should be sent when the tracker model is provisioned. The tracker model, must support GT06 or JT808, to work.
+// @Description  Add support for new model, by specifing which SMS messages should be sent when the tracker model is provisioned. The tracker model, must support GT06, JT808, Teltonika, H02, TK103 or Queclink, to work.
 // @Tags         Models
 // @Accept       json
 // @Produce      json
@@ -475,186 +826,1668 @@ func deleteModel(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "success"})
 }
 
-// @Summary      Get tracker location
-// @Description  Get the latest location data event reported by specified tracker
-// @Tags         Location
+// @Summary      Get drivers
+// @Description  If the user is a admin, it will respond with all drivers, and if the user is a regular user, it will return drivers who have driven trackers owned by the user
+// @Tags         Drivers
 // @Produce      json
-// @Param        id   path      string  true  "TrackerID"
-// @Success      200  {object}  LocationResponse
+// @Success      200  {array}   DriverResponse
 // @Failure      400  {object}  StringResultRes "API key required"
-// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
-// @Failure      404  {object}  StringResultRes "No location entry found"
-// @Router       /trackers/{id}/location [get]
+// @Failure      401  {object}  StringResultRes "Invalid API key"
+// @Router       /drivers [get]
 // @Security     ApiKeyAuth
-func getTrackerLocation(c *gin.Context) {
-	id := c.Param("id")
-	ld, err := database.GetLocation(id)
-	tm := timeToString(ld.Timestamp)
-	lr := LocationResponse{Timestamp: &tm, Lat: &ld.Lat, Lon: &ld.Lon, Speed: &ld.Speed, Heading: &ld.Heading}
-	if err != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+func getDrivers(c *gin.Context) {
+	var drivers []model.Driver
+	if c.GetBool("isadmin") {
+		drivers = database.GetDrivers()
+	} else {
+		drivers = database.GetDriversByUserId(c.GetInt("userId"))
+	}
+	out := make([]DriverResponse, len(drivers))
+	for i, d := range drivers {
+		out[i] = newDriverResponse(d)
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Get driver
+// @Description  Get driver by id
+// @Tags         Drivers
+// @Produce      json
+// @Param        driverId  path      int  true  "Driver id"
+// @Success      200  {object}  DriverResponse
+// @Failure      400  {object}  StringResultRes "invalid driver id OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to a driver with the specified id"
+// @Router       /drivers/{driverId} [get]
+// @Security     ApiKeyAuth
+func getDriver(c *gin.Context) {
+	d, ok := getAccessibleDriver(c)
+	if !ok {
 		return
 	}
-	c.IndentedJSON(http.StatusOK, lr)
+	c.IndentedJSON(http.StatusOK, newDriverResponse(d))
 }
 
-// @Summary      Get tracker locations
-// @Description  Get a array with all location data events reported by specified tracker
-// @Tags         Location
+// @Summary      Get driver trips
+// @Description  Get the periods specified driver was logged in to trackers. Regular users only get trips in trackers they own. Without start/end, trips from the last 24 hours are returned
+// @Tags         Drivers
 // @Produce      json
-// @Param        id   path      string  true  "TrackerID"
-// @Success      200  {array}  []LocationResponse
-// @Failure      400  {object}  StringResultRes "API key required"
-// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
-// @Failure      404  {object}  StringResultRes "No location entry found"
-// @Router       /trackers/{id}/locations [get]
+// @Param        driverId  path      int     true   "Driver id"
+// @Param        start     query     string  false  "RFC3339 or unix seconds"
+// @Param        end       query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   TripResponse
+// @Failure      400  {object}  StringResultRes "invalid driver id OR invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to a driver with the specified id"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /drivers/{driverId}/trips [get]
 // @Security     ApiKeyAuth
-func getTrackerLocations(c *gin.Context) {
-	id := c.Param("id")
-	// Optional query parameters: ?limit=N or ?start=RFC3339|unix&end=RFC3339|unix
-	// If start/end are provided, they take precedence over limit.
-	startQ := c.Query("start")
-	endQ := c.Query("end")
-	if startQ != "" || endQ != "" {
-		// Parse start and end
-		var start, end int64
-		var err error
-		// default end to now if missing
-		if endQ == "" {
-			end = time.Now().Unix()
-		} else {
-			end, err = parseTimeQuery(endQ)
-			if err != nil {
-				c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid end parameter"})
-				return
-			}
-		}
-		if startQ == "" {
-			// default start to 24 hours before end if missing
-			start = end - 24*3600
-		} else {
-			start, err = parseTimeQuery(startQ)
-			if err != nil {
-				c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid start parameter"})
-				return
-			}
-		}
-		ld, err := database.GetTrackerLocationHistoryRange(id, start, end)
-		if err != nil || len(ld) == 0 {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
-			return
+func getDriverTrips(c *gin.Context) {
+	d, ok := getAccessibleDriver(c)
+	if !ok {
+		return
+	}
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	var trips []model.Trip
+	if c.GetBool("isadmin") {
+		trips, err = database.GetDriverTrips(d.Id, start, end)
+	} else {
+		trips, err = database.GetDriverTripsByUserId(d.Id, c.GetInt("userId"), start, end)
+	}
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	out := make([]TripResponse, len(trips))
+	for i, tr := range trips {
+		out[i] = TripResponse{
+			Id:        tr.Id,
+			TrackerId: tr.TrackerId,
+			StartedAt: timeToString(tr.StartedAt),
 		}
-		lh := make([]LocationResponse, len(ld))
-		for i := 0; i < len(ld); i++ {
-			tm := timeToString(ld[i].Timestamp)
-			lh[i] = LocationResponse{Timestamp: &tm, Lat: &ld[i].Lat, Lon: &ld[i].Lon, Speed: &ld[i].Speed, Heading: &ld[i].Heading}
+		if tr.EndedAt != nil {
+			endedAt := timeToString(*tr.EndedAt)
+			out[i].EndedAt = &endedAt
 		}
-		c.IndentedJSON(http.StatusOK, lh)
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Get driver locations
+// @Description  Get locations reported while specified driver was logged in. Regular users only get locations reported by trackers they own. Without start/end, locations from the last 24 hours are returned
+// @Tags         Drivers
+// @Produce      json
+// @Param        driverId  path      int     true   "Driver id"
+// @Param        start     query     string  false  "RFC3339 or unix seconds"
+// @Param        end       query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   DriverLocationResponse
+// @Failure      400  {object}  StringResultRes "invalid driver id OR invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to a driver with the specified id"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /drivers/{driverId}/locations [get]
+// @Security     ApiKeyAuth
+func getDriverLocations(c *gin.Context) {
+	d, ok := getAccessibleDriver(c)
+	if !ok {
+		return
+	}
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
 		return
 	}
+	var ld []model.Locationdata
+	if c.GetBool("isadmin") {
+		ld, err = database.GetDriverLocationHistory(d.Id, start, end)
+	} else {
+		ld, err = database.GetDriverLocationHistoryByUserId(d.Id, c.GetInt("userId"), start, end)
+	}
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	out := make([]DriverLocationResponse, len(ld))
+	for i := range ld {
+		out[i] = DriverLocationResponse{TrackerId: ld[i].TrackerId, LocationResponse: newLocationResponse(&ld[i])}
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
 
-	// Optional query parameter: ?limit=N to fetch only the last N locations
-	limitStr := c.Query("limit")
-	if limitStr != "" {
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit <= 0 {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid limit parameter"})
-			return
+// Get driver specified by the driverId parameter if caller is admin or the driver has driven a tracker owned by caller
+// Responds with an error and returns false if not
+func getAccessibleDriver(c *gin.Context) (model.Driver, bool) {
+	id, err := strconv.Atoi(c.Param("driverId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid driver id"})
+		return model.Driver{}, false
+	}
+	d, err := database.GetDriver(id)
+	if err == nil && !c.GetBool("isadmin") {
+		accessible := slices.ContainsFunc(database.GetDriversByUserId(c.GetInt("userId")), func(ud model.Driver) bool {
+			return ud.Id == id
+		})
+		if !accessible {
+			err = fmt.Errorf("driver has not driven trackers owned by user")
 		}
-		ld, err := database.GetTrackerLocationHistoryLimit(id, limit)
-		if err != nil {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"result": "You don't have access to a driver with the specified id"})
+		return d, false
+	}
+	return d, true
+}
+
+func newDriverResponse(d model.Driver) DriverResponse {
+	return DriverResponse{
+		Id:                d.Id,
+		Name:              d.Name,
+		Certificate:       d.Certificate,
+		Agency:            d.Agency,
+		CertificateExpiry: d.CertificateExpiry,
+		IdNumber:          d.IdNumber,
+		LastSeen:          timeToString(d.LastSeen),
+	}
+}
+
+// @Summary      Get passthrough data
+// @Description  Get data passed through specified tracker from peripherals, such as serial port sensors. Without start/end, data from the last 24 hours is returned
+// @Tags         Passthrough
+// @Produce      json
+// @Param        id     path      string  true   "TrackerID"
+// @Param        start  query     string  false  "RFC3339 or unix seconds"
+// @Param        end    query     string  false  "RFC3339 or unix seconds"
+// @Param        type   query     int     false  "Only return data of this type"
+// @Success      200  {array}   PassthroughResponse
+// @Failure      400  {object}  StringResultRes "invalid start parameter OR invalid end parameter OR invalid type parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /trackers/{id}/passthrough [get]
+// @Security     ApiKeyAuth
+func getPassthroughData(c *gin.Context) {
+	id := c.Param("id")
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	var data []model.PassthroughData
+	if typeQ := c.Query("type"); typeQ == "" {
+		data, err = database.GetTrackerPassthroughData(id, start, end)
+	} else {
+		passthroughType, perr := strconv.ParseUint(typeQ, 0, 8)
+		if perr != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid type parameter"})
 			return
 		}
-		// DB returns latest-first (DESC). Return chronological order (oldest -> newest) to callers.
-		for i, j := 0, len(ld)-1; i < j; i, j = i+1, j-1 {
-			ld[i], ld[j] = ld[j], ld[i]
-		}
-		lh := make([]LocationResponse, len(ld))
-		for i := 0; i < len(ld); i++ {
-			tm := timeToString(ld[i].Timestamp)
-			lh[i] = LocationResponse{Timestamp: &tm, Lat: &ld[i].Lat, Lon: &ld[i].Lon, Speed: &ld[i].Speed, Heading: &ld[i].Heading}
-		}
-		c.IndentedJSON(http.StatusOK, lh)
-		return
+		data, err = database.GetTrackerPassthroughDataByType(id, uint8(passthroughType), start, end)
 	}
-
-	// No limit provided: return full history
-	ld, err := database.GetTrackerLocationHistory(id)
 	if err != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
 		return
 	}
-	lh := make([]LocationResponse, len(ld))
-	for i := 0; i < len(ld); i++ {
-		tm := timeToString(ld[i].Timestamp)
-		lh[i] = LocationResponse{Timestamp: &tm, Lat: &ld[i].Lat, Lon: &ld[i].Lon, Speed: &ld[i].Speed, Heading: &ld[i].Heading}
+	out := make([]PassthroughResponse, len(data))
+	for i, d := range data {
+		out[i] = PassthroughResponse{
+			Id:        d.EntryId,
+			Timestamp: timeToString(d.Timestamp),
+			Type:      d.Type,
+			TypeName:  jt808.PassthroughTypeName(d.Type),
+			Data:      hex.EncodeToString(d.Data),
+		}
 	}
-	c.IndentedJSON(http.StatusOK, lh)
+	c.IndentedJSON(http.StatusOK, out)
 }
 
-// @Summary      Send command
-// @Description  Send upstream command to specified tracker, and get tracker response. The request will fail if the tracker is not currently connected. Additionally the request may timeout, if the tracker is connected but does not response. This can happen if the tracker has entered sleep mode without first closing the TCP connection
-// @Tags         Commands
-// @Produce      json
+// @Summary      Send passthrough data
+// @Description  Send raw data to a peripheral of a connected JT808 tracker, such as a serial port sensor
+// @Tags         Passthrough
 // @Accept       json
+// @Produce      json
 // @Param        id   path      string  true  "TrackerID"
-// @Param        body   body CommandReq  true  "Command"
-// @Success      200  {object}  StringResultRes "RESPONSE"
-// @Failure      400  {object}  StringResultRes "failed to parse OR API key required"
+// @Param        body body PassthroughReq true "Passthrough data"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Only supported by JT808 trackers"
 // @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      409  {object}  StringResultRes "Another sub-packaged message is being sent to the tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
 // @Failure      503  {object}  StringResultRes "The tracker is not connected"
-// @Router       /trackers/{id}/command [post]
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/passthrough [post]
 // @Security     ApiKeyAuth
-func sendCommand(c *gin.Context) {
-	var cmd CommandReq
+func sendPassthroughData(c *gin.Context) {
 	id := c.Param("id")
-
-	active := getActiveHandlersId()
-	// Abort if tracker is not connected
-	if !slices.Contains(active, id) {
-		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"result": "The tracker is not connected"})
+	var req PassthroughReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
 		return
 	}
-	if err := c.BindJSON(&cmd); err != nil {
+	data, err := hex.DecodeString(req.Data)
+	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
 		return
 	}
-	// Create response channel
-	resChannel := make(chan string)
-	// Create TrackerCommand object and pass to command queue
-	tc := model.TrackerCommand{TrackerId: id, Payload: cmd.Command, Response: resChannel}
-	tm.CommandQueue <- tc
-	// Wait for response
-	res := <-resChannel
-	// Pass response to API caller
-	c.IndentedJSON(http.StatusOK, gin.H{"result": res})
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeDownstreamData, jt808.EncodePassthrough(req.Type, data))
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
 }
 
-// @Summary      Whoami
-// @Description  Fetch the user/organization name associated with the used API key. This can be used to detect if a api-key is valid
-// @Tags         Authentication
+// @Summary      Get firmware
+// @Description  Get a list of all uploaded firmware
+// @Tags         Firmware
 // @Produce      json
-// @Success      200  {object}  NameRes "NAME OF USER/ORGANISATION"
+// @Success      200  {array}   FirmwareResponse
 // @Failure      400  {object}  StringResultRes "API key required"
-// @Failure      401  {object}  StringResultRes "Invalid API key"
-// @Router       /whoami [get]
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to this feature"
+// @Router       /firmware [get]
 // @Security     ApiKeyAuth
-func whoami(c *gin.Context) {
-	name := c.GetString("name")
-	c.IndentedJSON(http.StatusOK, gin.H{"name": name})
-}
-
-// Misc
-func timeToString(t int64) string {
-	return time.Unix(t, 0).Format(time.RFC3339)
+func getFirmware(c *gin.Context) {
+	firmware := database.GetAllFirmware()
+	out := make([]FirmwareResponse, len(firmware))
+	for i, f := range firmware {
+		out[i] = newFirmwareResponse(f)
+	}
+	c.IndentedJSON(http.StatusOK, out)
 }
 
-func getActiveHandlersId() []string {
-	tm.Mu.Lock()
-	keys := maps.Keys(tm.Handlers)
-	tm.Mu.Unlock()
-	return slices.Collect(keys)
+// @Summary      Upload firmware
+// @Description  Upload firmware for a tracker model, which can be pushed to connected JT808 trackers of the model
+// @Tags         Firmware
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file            formData  file    true   "Firmware file"
+// @Param        model           formData  string  true   "Model name"
+// @Param        version         formData  string  true   "Firmware version"
+// @Param        type            formData  int     false  "0 (terminal), 12 (IC card reader) or 52 (GNSS module)"
+// @Param        manufacturerId  formData  string  false  "Manufacturer id"
+// @Success      200  {object}  FirmwareResponse
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Firmware file is too large"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to this feature"
+// @Failure      404  {object}  StringResultRes "Model was not found"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /firmware [post]
+// @Security     ApiKeyAuth
+func uploadFirmware(c *gin.Context) {
+	var req FirmwareReq
+	if err := c.ShouldBind(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	if req.File.Size > maxFirmwareSize {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "Firmware file is too large"})
+		return
+	}
+	if _, err := database.GetModel(req.Model); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "Model was not found"})
+		return
+	}
+	file, err := req.File.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	f, err := database.SaveFirmware(model.Firmware{
+		Model:          req.Model,
+		Version:        req.Version,
+		Type:           req.Type,
+		ManufacturerId: req.ManufacturerId,
+		UploadedAt:     time.Now().Unix(),
+	}, data)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newFirmwareResponse(f))
+}
+
+// @Summary      Delete firmware
+// @Description  Delete uploaded firmware and the upgrade history of it
+// @Tags         Firmware
+// @Produce      json
+// @Param        firmwareId  path      int  true  "Firmware id"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "invalid firmware id OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have access to this feature"
+// @Failure      404  {object}  StringResultRes "Firmware was not found"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /firmware/{firmwareId} [delete]
+// @Security     ApiKeyAuth
+func deleteFirmware(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("firmwareId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid firmware id"})
+		return
+	}
+	f, err := database.GetFirmware(id)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "Firmware was not found"})
+		return
+	}
+	if err := database.DeleteFirmware(f); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// @Summary      Get firmware upgrades
+// @Description  Get the firmware upgrades of specified tracker, with the progress of sending the firmware and the result reported by the tracker
+// @Tags         Firmware
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {array}   FirmwareUpgradeResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker OR You don't have access to this feature"
+// @Router       /trackers/{id}/firmware [get]
+// @Security     ApiKeyAuth
+func getFirmwareUpgrades(c *gin.Context) {
+	upgrades := database.GetFirmwareUpgrades(c.Param("id"))
+	out := make([]FirmwareUpgradeResponse, len(upgrades))
+	for i, u := range upgrades {
+		out[i] = newFirmwareUpgradeResponse(u)
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Upgrade firmware
+// @Description  Push firmware to a connected JT808 tracker of the model the firmware is for. The firmware is sent in the background, and the progress and result are available from the firmware upgrades of the tracker
+// @Tags         Firmware
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body FirmwareUpgradeReq true "Firmware to push"
+// @Success      202  {object}  FirmwareUpgradeResponse
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Only supported by JT808 trackers OR Firmware is not for the model of the tracker"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker OR You don't have access to this feature"
+// @Failure      404  {object}  StringResultRes "Firmware was not found"
+// @Failure      409  {object}  StringResultRes "A firmware upgrade is already being sent"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Router       /trackers/{id}/firmware [post]
+// @Security     ApiKeyAuth
+func upgradeFirmware(c *gin.Context) {
+	id := c.Param("id")
+	var req FirmwareUpgradeReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	f, err := database.GetFirmware(req.FirmwareId)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "Firmware was not found"})
+		return
+	}
+	t, err := database.GetTracker(id)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	if t.Model != f.Model {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "Firmware is not for the model of the tracker"})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	for _, u := range database.GetFirmwareUpgrades(id) {
+		if u.Status == model.FirmwareUpgradeSending {
+			c.IndentedJSON(http.StatusConflict, gin.H{"result": "A firmware upgrade is already being sent"})
+			return
+		}
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	handler, _ := getActiveHandler(id)
+	body := jt808.EncodeUpgrade(f, data, handler.ProtocolVersion)
+	now := time.Now().Unix()
+	u := model.FirmwareUpgrade{
+		TrackerId:     id,
+		FirmwareId:    f.Id,
+		StartedAt:     now,
+		UpdatedAt:     now,
+		Status:        model.FirmwareUpgradeSending,
+		TotalPackages: jt808.SubPackageCount(body),
+	}
+	u.Id, err = database.CreateFirmwareUpgrade(u)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	go runFirmwareUpgrade(u, body)
+	c.IndentedJSON(http.StatusAccepted, newFirmwareUpgradeResponse(u))
+}
+
+func newFirmwareResponse(f model.Firmware) FirmwareResponse {
+	return FirmwareResponse{
+		Id:             f.Id,
+		Model:          f.Model,
+		Version:        f.Version,
+		Type:           f.Type,
+		ManufacturerId: f.ManufacturerId,
+		Size:           f.Size,
+		UploadedAt:     timeToString(f.UploadedAt),
+	}
+}
+
+func newFirmwareUpgradeResponse(u model.FirmwareUpgrade) FirmwareUpgradeResponse {
+	return FirmwareUpgradeResponse{
+		Id:            u.Id,
+		FirmwareId:    u.FirmwareId,
+		StartedAt:     timeToString(u.StartedAt),
+		UpdatedAt:     timeToString(u.UpdatedAt),
+		Status:        u.Status,
+		SentPackages:  u.SentPackages,
+		TotalPackages: u.TotalPackages,
+	}
+}
+
+// @Summary      Get tracker location
+// @Description  Get the latest location data event reported by specified tracker
+// @Tags         Location
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  LocationResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "No location entry found"
+// @Router       /trackers/{id}/location [get]
+// @Security     ApiKeyAuth
+func getTrackerLocation(c *gin.Context) {
+	id := c.Param("id")
+	ld, err := database.GetLocation(id)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newLocationResponse(&ld))
+}
+
+// @Summary      Locate tracker
+// @Description  Ask a connected JT808 tracker for its current position and wait for the response. The position is also stored in the location history
+// @Tags         Location
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  LocationResponse
+// @Failure      400  {object}  StringResultRes "API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/locate [post]
+// @Security     ApiKeyAuth
+func locateTracker(c *gin.Context) {
+	id := c.Param("id")
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeQueryLocation, []byte{})
+	if !ok {
+		return
+	}
+	ld, err := jt808.ParseQueryLocationRes(p.Payload)
+	if p.PacketType != jt808.MsgTypeQueryLocationRes || err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "Invalid response from tracker"})
+		return
+	}
+	utils.StdLatLon(&ld, jt808.CoordinatePrecision)
+	ld.TrackerId = id
+	ld.ReceivedAt = time.Now().Unix()
+	c.IndentedJSON(http.StatusOK, newLocationResponse(&ld))
+}
+
+// @Summary      Get tracker locations
+// @Description  Get a array with all location data events reported by specified tracker
+// @Tags         Location
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {array}  []LocationResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "No location entry found"
+// @Router       /trackers/{id}/locations [get]
+// @Security     ApiKeyAuth
+func getTrackerLocations(c *gin.Context) {
+	id := c.Param("id")
+	// Optional query parameters: ?limit=N or ?start=RFC3339|unix&end=RFC3339|unix
+	// If start/end are provided, they take precedence over limit.
+	if c.Query("start") != "" || c.Query("end") != "" {
+		start, end, err := parseTimeRangeQuery(c)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+			return
+		}
+		ld, err := database.GetTrackerLocationHistoryRange(id, start, end)
+		if err != nil || len(ld) == 0 {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, newLocationHistoryResponse(ld))
+		return
+	}
+
+	// Optional query parameter: ?limit=N to fetch only the last N locations
+	limitStr := c.Query("limit")
+	if limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid limit parameter"})
+			return
+		}
+		ld, err := database.GetTrackerLocationHistoryLimit(id, limit)
+		if err != nil {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+			return
+		}
+		// DB returns latest-first (DESC). Return chronological order (oldest -> newest) to callers.
+		for i, j := 0, len(ld)-1; i < j; i, j = i+1, j-1 {
+			ld[i], ld[j] = ld[j], ld[i]
+		}
+		c.IndentedJSON(http.StatusOK, newLocationHistoryResponse(ld))
+		return
+	}
+
+	// No limit provided: return full history
+	ld, err := database.GetTrackerLocationHistory(id)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No location entry found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newLocationHistoryResponse(ld))
+}
+
+// Convert a model.Locationdata struct to a LocationResponse object
+func newLocationResponse(ld *model.Locationdata) LocationResponse {
+	timestamp := timeToString(ld.Timestamp)
+	receivedAt := timeToString(ld.ReceivedAt)
+	return LocationResponse{
+		Timestamp:      &timestamp,
+		ReceivedAt:     &receivedAt,
+		Lat:            &ld.Lat,
+		Lon:            &ld.Lon,
+		Speed:          &ld.Speed,
+		Heading:        &ld.Heading,
+		Historic:       &ld.Historic,
+		Altitude:       &ld.Altitude,
+		AlarmFlags:     &ld.AlarmFlags,
+		Status:         &ld.Status,
+		Mileage:        ld.Mileage,
+		Fuel:           ld.Fuel,
+		RecorderSpeed:  ld.RecorderSpeed,
+		SignalStrength: ld.SignalStrength,
+		Satellites:     ld.Satellites,
+		DriverId:       ld.DriverId,
+	}
+}
+
+func newLocationHistoryResponse(ld []model.Locationdata) []LocationResponse {
+	lh := make([]LocationResponse, len(ld))
+	for i := range ld {
+		lh[i] = newLocationResponse(&ld[i])
+	}
+	return lh
+}
+
+// @Summary      Send command
+// @Description  Send upstream command to specified tracker, and get tracker response. The request will fail if the tracker is not currently connected. Additionally the request may timeout, if the tracker is connected but does not response. This can happen if the tracker has entered sleep mode without first closing the TCP connection
+// @Tags         Commands
+// @Produce      json
+// @Accept       json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body   body CommandReq  true  "Command"
+// @Success      200  {object}  StringResultRes "RESPONSE"
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Router       /trackers/{id}/command [post]
+// @Security     ApiKeyAuth
+func sendCommand(c *gin.Context) {
+	var cmd CommandReq
+	id := c.Param("id")
+
+	active := getActiveHandlersId()
+	// Abort if tracker is not connected
+	if !slices.Contains(active, id) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"result": "The tracker is not connected"})
+		return
+	}
+	if err := c.BindJSON(&cmd); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	// Create response channel
+	resChannel := make(chan string)
+	// Create TrackerCommand object and pass to command queue
+	tc := model.TrackerCommand{TrackerId: id, Payload: cmd.Command, Response: resChannel}
+	tm.CommandQueue <- tc
+	// Wait for response
+	res := <-resChannel
+	// Pass response to API caller
+	c.IndentedJSON(http.StatusOK, gin.H{"result": res})
+}
+
+// @Summary      Get tracker status
+// @Description  Get the latest terminal status (battery, GSM signal, ACC, charging) reported by specified tracker
+// @Tags         Status
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  StatusResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "No status entry found"
+// @Router       /trackers/{id}/status [get]
+// @Security     ApiKeyAuth
+func getTrackerStatus(c *gin.Context) {
+	ts, err := database.GetTerminalStatus(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No status entry found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newStatusResponse(ts))
+}
+
+// @Summary      Get tracker status history
+// @Description  Get terminal status history reported by specified tracker. Without start/end, statuses from the last 24 hours are returned
+// @Tags         Status
+// @Produce      json
+// @Param        id     path      string  true   "TrackerID"
+// @Param        start  query     string  false  "RFC3339 or unix seconds"
+// @Param        end    query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   StatusResponse
+// @Failure      400  {object}  StringResultRes "invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "No status entry found"
+// @Router       /trackers/{id}/statuses [get]
+// @Security     ApiKeyAuth
+func getTrackerStatuses(c *gin.Context) {
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	history, err := database.GetTerminalStatusHistoryRange(c.Param("id"), start, end)
+	if err != nil || len(history) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No status entry found"})
+		return
+	}
+	out := make([]StatusResponse, len(history))
+	for i, ts := range history {
+		out[i] = newStatusResponse(ts)
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// Convert a model.TerminalStatus struct to a StatusResponse object
+func newStatusResponse(ts model.TerminalStatus) StatusResponse {
+	return StatusResponse{
+		Timestamp:       timeToString(ts.Timestamp),
+		OilCut:          ts.OilCut,
+		GPSTracking:     ts.GPSTracking,
+		Alarm:           ts.Alarm,
+		Charging:        ts.Charging,
+		ACC:             ts.ACC,
+		Defense:         ts.Defense,
+		VoltageLevel:    ts.VoltageLevel,
+		ExternalVoltage: ts.ExternalVoltage,
+		GSMSignal:       ts.GSMSignal,
+	}
+}
+
+// @Summary      Get tracker alarms
+// @Description  Get alarms raised by specified tracker. Without start/end, alarms from the last 24 hours are returned
+// @Tags         Alarms
+// @Produce      json
+// @Param        id     path      string  true   "TrackerID"
+// @Param        start  query     string  false  "RFC3339 or unix seconds"
+// @Param        end    query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   AlarmResponse
+// @Failure      400  {object}  StringResultRes "invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /trackers/{id}/alarms [get]
+// @Security     ApiKeyAuth
+func getTrackerAlarms(c *gin.Context) {
+	id := c.Param("id")
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	alarms, err := database.GetTrackerAlarms(id, start, end)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newAlarmResponse(alarms))
+}
+
+// @Summary      Acknowledge alarm
+// @Description  Acknowledge an alarm raised by a connected JT808 tracker, which stops the tracker from repeating it. Only SOS, danger warning, region, route, route driving time, illegal ignition and illegal displacement alarms can be acknowledged. The user acknowledging the alarm is recorded
+// @Tags         Alarms
+// @Produce      json
+// @Param        id       path      string  true  "TrackerID"
+// @Param        alarmId  path      int     true  "Id of alarm entry"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "invalid alarm id OR API key required OR Only supported by JT808 trackers OR Only JT808 alarms can be acknowledged OR The alarm type can not be acknowledged"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "Alarm was not found"
+// @Failure      409  {object}  StringResultRes "The alarm has already been acknowledged"
+// @Failure      500  {object}  StringResultRes "Failed to store acknowledgement"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/alarms/{alarmId}/acknowledge [post]
+// @Security     ApiKeyAuth
+func acknowledgeAlarm(c *gin.Context) {
+	id := c.Param("id")
+	entryId, err := strconv.Atoi(c.Param("alarmId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid alarm id"})
+		return
+	}
+	a, err := database.GetAlarm(id, entryId)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "Alarm was not found"})
+		return
+	}
+	if a.SerialNumber == nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "Only JT808 alarms can be acknowledged"})
+		return
+	}
+	if !jt808.IsManualAckAlarm(a.Type) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "The alarm type can not be acknowledged"})
+		return
+	}
+	if a.AcknowledgedAt != nil {
+		c.IndentedJSON(http.StatusConflict, gin.H{"result": "The alarm has already been acknowledged"})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeAlarmAck, jt808.EncodeAlarmAck(*a.SerialNumber, a.Type))
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	if err := database.AcknowledgeAlarm(a.EntryId, c.GetInt("userId"), time.Now().Unix()); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "Failed to store acknowledgement"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// @Summary      Get alarms
+// @Description  If the user is a admin, it will respond with alarms raised by all trackers in the system, and if the user is a regular user, it will return alarms raised by trackers owned by the user. Without start/end, alarms from the last 24 hours are returned
+// @Tags         Alarms
+// @Produce      json
+// @Param        start  query     string  false  "RFC3339 or unix seconds"
+// @Param        end    query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   AlarmResponse
+// @Failure      400  {object}  StringResultRes "invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /alarms [get]
+// @Security     ApiKeyAuth
+func getAlarms(c *gin.Context) {
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	var alarms []model.Alarm
+	if c.GetBool("isadmin") {
+		alarms, err = database.GetAlarms(start, end)
+	} else {
+		alarms, err = database.GetAlarmsByUserId(c.GetInt("userId"), start, end)
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newAlarmResponse(alarms))
+}
+
+// Convert model.Alarm structs to AlarmResponse objects
+func newAlarmResponse(alarms []model.Alarm) []AlarmResponse {
+	out := make([]AlarmResponse, len(alarms))
+	for i, a := range alarms {
+		out[i] = AlarmResponse{
+			Id:             a.EntryId,
+			TrackerId:      a.TrackerId,
+			Timestamp:      timeToString(a.Timestamp),
+			Type:           a.Type,
+			Name:           a.Name,
+			Lat:            a.Lat,
+			Lon:            a.Lon,
+			AcknowledgedBy: a.AcknowledgedBy,
+		}
+		if a.AcknowledgedAt != nil {
+			acknowledgedAt := timeToString(*a.AcknowledgedAt)
+			out[i].AcknowledgedAt = &acknowledgedAt
+		}
+	}
+	return out
+}
+
+// @Summary      Get terminal parameters
+// @Description  Query heartbeat interval, report interval, server address, APN and overspeed threshold of a connected JT808 tracker. Parameters not reported by the tracker are null
+// @Tags         Parameters
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  jt808.Parameters
+// @Failure      400  {object}  StringResultRes "API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/parameters [get]
+// @Security     ApiKeyAuth
+func getParameters(c *gin.Context) {
+	id := c.Param("id")
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	msgType, body := jt808.EncodeQueryParams(jt808.ParameterIds)
+	p, ok := sendTrackerMsg(c, id, msgType, body)
+	if !ok {
+		return
+	}
+	params, err := jt808.ParseQueryParamsRes(p.Payload)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "Invalid response from tracker"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, params)
+}
+
+// @Summary      Set terminal parameters
+// @Description  Set heartbeat interval, report interval, server address, APN and/or overspeed threshold of a connected JT808 tracker. Only the provided parameters are changed
+// @Tags         Parameters
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body ParametersReq true "Parameters to set"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "failed to parse OR no parameters provided OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      409  {object}  StringResultRes "Another sub-packaged message is being sent to the tracker"
+// @Failure      502  {object}  StringResultRes "The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/parameters [put]
+// @Security     ApiKeyAuth
+func setParameters(c *gin.Context) {
+	id := c.Param("id")
+	var req ParametersReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	params := jt808.Parameters{
+		HeartbeatInterval:  req.HeartbeatInterval,
+		ReportInterval:     req.ReportInterval,
+		ServerAddress:      req.ServerAddress,
+		ServerPort:         req.ServerPort,
+		APN:                req.APN,
+		OverspeedThreshold: req.OverspeedThreshold,
+	}
+	body := jt808.EncodeSetParams(params)
+	if body[0] == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "no parameters provided"})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeSetParams, body)
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// Terminal control command words of the commands accepted by the API
+var controlCommands = map[string]uint8{
+	"reboot":        jt808.ControlReset,
+	"factoryReset":  jt808.ControlFactoryReset,
+	"connectServer": jt808.ControlConnectServer,
+	"closeDataLink": jt808.ControlCloseDataLink,
+	"radioOff":      jt808.ControlCloseRadio,
+}
+
+// @Summary      Control terminal
+// @Description  Reboot, factory reset, close the data link, turn off the radio, or connect a JT808 tracker to the specified server. The tracker may disconnect after acknowledging the command
+// @Tags         Commands
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body TerminalControlReq true "Control command"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/control [post]
+// @Security     ApiKeyAuth
+func controlTerminal(c *gin.Context) {
+	id := c.Param("id")
+	var req TerminalControlReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	var server *jt808.ServerConnection
+	if req.Server != nil {
+		server = &jt808.ServerConnection{
+			AuthCode:  req.Server.AuthCode,
+			APN:       req.Server.APN,
+			Username:  req.Server.Username,
+			Password:  req.Server.Password,
+			Address:   req.Server.Address,
+			TCPPort:   req.Server.TCPPort,
+			UDPPort:   req.Server.UDPPort,
+			TimeLimit: req.Server.TimeLimit,
+		}
+	}
+	body, err := jt808.EncodeTerminalControl(controlCommands[req.Command], server)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeTermControl, body)
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// @Summary      Get tracking session
+// @Description  Get the active temporary tracking session of specified tracker
+// @Tags         Tracking
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  TrackingSessionResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "No active tracking session"
+// @Router       /trackers/{id}/tracking [get]
+// @Security     ApiKeyAuth
+func getTracking(c *gin.Context) {
+	ts, err := database.GetActiveTrackingSession(c.Param("id"), time.Now().Unix())
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "No active tracking session"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newTrackingSessionResponse(ts))
+}
+
+// @Summary      Start tracking session
+// @Description  Instruct a connected JT808 tracker to report its position every interval seconds for duration minutes, after which it returns to its normal interval. Replaces any active session
+// @Tags         Tracking
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body TrackingReq true "Interval in seconds and duration in minutes"
+// @Success      200  {object}  TrackingSessionResponse
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      500  {object}  StringResultRes "Failed to store tracking session"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/tracking [post]
+// @Security     ApiKeyAuth
+func startTracking(c *gin.Context) {
+	id := c.Param("id")
+	var req TrackingReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	validity := req.Duration * 60
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeTempTracking, jt808.EncodeTempTracking(req.Interval, validity))
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	// The new session replaces the active one on the tracker
+	now := time.Now().Unix()
+	ts := model.TrackingSession{
+		TrackerId: id,
+		UserId:    c.GetInt("userId"),
+		StartedAt: now,
+		Interval:  req.Interval,
+		ExpiresAt: now + int64(validity),
+	}
+	if err := database.StopTrackingSessions(id, now); err != nil {
+		log.Println(err)
+	}
+	if err := database.InsertTrackingSession(ts); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "Failed to store tracking session"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newTrackingSessionResponse(ts))
+}
+
+// @Summary      Stop tracking session
+// @Description  Instruct a connected JT808 tracker to stop temporary tracking and return to its normal interval
+// @Tags         Tracking
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      500  {object}  StringResultRes "Failed to stop tracking session"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/tracking [delete]
+// @Security     ApiKeyAuth
+func stopTracking(c *gin.Context) {
+	id := c.Param("id")
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeTempTracking, jt808.EncodeTempTracking(0, 0))
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	if err := database.StopTrackingSessions(id, time.Now().Unix()); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "Failed to stop tracking session"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// Convert a model.TrackingSession struct to a TrackingSessionResponse object
+func newTrackingSessionResponse(ts model.TrackingSession) TrackingSessionResponse {
+	return TrackingSessionResponse{
+		UserId:    ts.UserId,
+		StartedAt: timeToString(ts.StartedAt),
+		Interval:  ts.Interval,
+		ExpiresAt: timeToString(ts.ExpiresAt),
+	}
+}
+
+// @Summary      Get tracker media
+// @Description  Get metadata of photos and recordings uploaded by specified tracker. Without start/end, media from the last 24 hours is returned
+// @Tags         Media
+// @Produce      json
+// @Param        id     path      string  true   "TrackerID"
+// @Param        start  query     string  false  "RFC3339 or unix seconds"
+// @Param        end    query     string  false  "RFC3339 or unix seconds"
+// @Success      200  {array}   MediaResponse
+// @Failure      400  {object}  StringResultRes "invalid start parameter OR invalid end parameter OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /trackers/{id}/media [get]
+// @Security     ApiKeyAuth
+func getTrackerMedia(c *gin.Context) {
+	start, end, err := parseTimeRangeQuery(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": err.Error()})
+		return
+	}
+	media, err := database.GetTrackerMedia(c.Param("id"), start, end)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	out := make([]MediaResponse, len(media))
+	for i, m := range media {
+		out[i] = MediaResponse{
+			Id:         m.EntryId,
+			MediaId:    m.MediaId,
+			Type:       jt808.MediaTypeName(m.Type),
+			Format:     jt808.MediaExtension(m.Format),
+			Event:      m.Event,
+			Channel:    m.Channel,
+			Timestamp:  timeToString(m.Timestamp),
+			ReceivedAt: timeToString(m.ReceivedAt),
+			Lat:        m.Lat,
+			Lon:        m.Lon,
+			AlarmFlags: m.AlarmFlags,
+			Size:       m.Size,
+		}
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Download tracker media
+// @Description  Download photo or recording uploaded by specified tracker
+// @Tags         Media
+// @Produce      octet-stream
+// @Param        id       path      string  true  "TrackerID"
+// @Param        mediaId  path      int     true  "Id of media entry"
+// @Success      200  {file}    file
+// @Failure      400  {object}  StringResultRes "invalid media id OR API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      404  {object}  StringResultRes "Media was not found"
+// @Router       /trackers/{id}/media/{mediaId} [get]
+// @Security     ApiKeyAuth
+func getTrackerMediaFile(c *gin.Context) {
+	entryId, err := strconv.Atoi(c.Param("mediaId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid media id"})
+		return
+	}
+	m, err := database.GetMedia(c.Param("id"), entryId)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"result": "Media was not found"})
+		return
+	}
+	c.FileAttachment(m.Path, filepath.Base(m.Path))
+}
+
+// @Summary      Take snapshot
+// @Description  Instruct a connected JT808 tracker to take photos with the specified camera channel. Unless saved on the tracker, the photos are uploaded and available as media afterwards
+// @Tags         Media
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body SnapshotReq true "Snapshot parameters"
+// @Success      200  {object}  SnapshotResponse
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request OR The tracker failed to take the snapshot"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/snapshot [post]
+// @Security     ApiKeyAuth
+func takeSnapshot(c *gin.Context) {
+	id := c.Param("id")
+	req := SnapshotReq{Count: 1, Resolution: 1, Quality: 5}
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	// Image settings are set to the middle of their range
+	body := jt808.EncodeSnapshot(jt808.Snapshot{
+		Channel:    req.Channel,
+		Count:      req.Count,
+		Interval:   req.Interval,
+		Save:       req.Save,
+		Resolution: req.Resolution,
+		Quality:    req.Quality,
+		Brightness: 128,
+		Contrast:   64,
+		Saturation: 64,
+		Chroma:     128,
+	})
+	p, ok := sendTrackerMsg(c, id, jt808.MsgTypeSnapshot, body)
+	if !ok {
+		return
+	}
+	// Some terminals acknowledge with a universal response instead of reporting the media ids
+	if p.PacketType == jt808.MsgTypeTermUniversalRes {
+		if requireUniversalSuccess(c, p) {
+			c.IndentedJSON(http.StatusOK, SnapshotResponse{MediaIds: []uint32{}})
+		}
+		return
+	}
+	result, ids, err := jt808.ParseSnapshotRes(p.Payload)
+	if p.PacketType != jt808.MsgTypeSnapshotRes || err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "Invalid response from tracker"})
+		return
+	}
+	if result != jt808.ResultSuccess {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "The tracker failed to take the snapshot"})
+		return
+	}
+	if ids == nil {
+		ids = []uint32{}
+	}
+	c.IndentedJSON(http.StatusOK, SnapshotResponse{MediaIds: ids})
+}
+
+// @Summary      Get list of regions
+// @Description  If the user is a admin, it will respond with a list of all regions in the system, and if the user is a regular user, it will return all regions owned by the user
+// @Tags         Regions
+// @Produce      json
+// @Success      200  {array}   RegionResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key"
+// @Router       /regions [get]
+// @Security     ApiKeyAuth
+func getRegions(c *gin.Context) {
+	var regions []model.Region
+	if c.GetBool("isadmin") {
+		regions = database.GetRegions()
+	} else {
+		regions = database.GetRegionsByOwner(c.GetInt("userId"))
+	}
+	out := make([]RegionResponse, len(regions))
+	for i, r := range regions {
+		out[i] = newRegionResponse(r)
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Get region
+// @Tags         Regions
+// @Produce      json
+// @Param        regionId   path      int  true  "RegionID"
+// @Success      200  {object}  RegionResponse
+// @Failure      400  {object}  StringResultRes "API key required OR invalid region id"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have a region with the specified id"
+// @Router       /regions/{regionId} [get]
+// @Security     ApiKeyAuth
+func getRegion(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, newRegionResponse(c.MustGet("region").(model.Region)))
+}
+
+// @Summary      Create region
+// @Description  Define a circle, rectangle, polygon or route, which can then be pushed to JT808 trackers
+// @Tags         Regions
+// @Accept       json
+// @Produce      json
+// @Param        body body RegionReq true "Region"
+// @Success      200  {object}  RegionResponse
+// @Failure      400  {object}  StringResultRes "failed to parse OR API key required OR invalid region"
+// @Failure      401  {object}  StringResultRes "Invalid API key"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /regions [post]
+// @Security     ApiKeyAuth
+func createRegion(c *gin.Context) {
+	var req RegionReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	r := model.Region{
+		Owner:             c.GetInt("userId"),
+		Name:              req.Name,
+		Type:              req.Type,
+		Radius:            req.Radius,
+		Width:             req.Width,
+		MaxSpeed:          req.MaxSpeed,
+		OverspeedDuration: req.OverspeedDuration,
+		AlarmOnEnter:      req.AlarmOnEnter,
+		AlarmOnExit:       req.AlarmOnExit,
+	}
+	for _, p := range req.Points {
+		r.Points = append(r.Points, model.Point{Lat: p.Lat, Lon: p.Lon})
+	}
+	// Verify the region can be encoded before storing it
+	if _, _, err := jt808.EncodeSetRegion(r, jt808.Version2013); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid region: " + err.Error()})
+		return
+	}
+	id, err := database.CreateRegion(r)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	r.Id = id
+	c.IndentedJSON(http.StatusOK, newRegionResponse(r))
+}
+
+// @Summary      Delete region
+// @Description  Delete region from the server. Regions held by trackers must be removed from them first
+// @Tags         Regions
+// @Produce      json
+// @Param        regionId   path      int  true  "RegionID"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "API key required OR invalid region id"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR You don't have a region with the specified id"
+// @Failure      409  {object}  StringResultRes "The region is held by trackers"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Router       /regions/{regionId} [delete]
+// @Security     ApiKeyAuth
+func deleteRegion(c *gin.Context) {
+	r := c.MustGet("region").(model.Region)
+	holders, err := database.CountRegionHolders(r.Id)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	if holders > 0 {
+		c.IndentedJSON(http.StatusConflict, gin.H{"result": "The region is held by trackers"})
+		return
+	}
+	if err := database.DeleteRegion(r.Id); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// @Summary      Get tracker regions
+// @Description  Get the regions currently held by specified tracker
+// @Tags         Regions
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Success      200  {array}   RegionResponse
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker"
+// @Router       /trackers/{id}/regions [get]
+// @Security     ApiKeyAuth
+func getTrackerRegions(c *gin.Context) {
+	regions := database.GetTrackerRegions(c.Param("id"))
+	out := make([]RegionResponse, len(regions))
+	for i, tr := range regions {
+		out[i] = newRegionResponse(tr.Region)
+		pushedAt := timeToString(tr.PushedAt)
+		out[i].PushedAt = &pushedAt
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+// @Summary      Push region to tracker
+// @Description  Add region to a connected JT808 tracker. The tracker raises region alarms on its own, also while not connected to the server
+// @Tags         Regions
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "TrackerID"
+// @Param        body body TrackerRegionReq true "Region to push"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "failed to parse OR invalid region id OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker OR You don't have a region with the specified id"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Failure      409  {object}  StringResultRes "Another sub-packaged message is being sent to the tracker"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/regions [post]
+// @Security     ApiKeyAuth
+func pushTrackerRegion(c *gin.Context) {
+	id := c.Param("id")
+	var req TrackerRegionReq
+	if err := c.BindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "failed to parse"})
+		return
+	}
+	r, ok := getAccessibleRegion(c, req.RegionId)
+	if !ok {
+		return
+	}
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	handler, _ := getActiveHandler(id)
+	msgType, body, err := jt808.EncodeSetRegion(r, handler.ProtocolVersion)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid region: " + err.Error()})
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, msgType, body)
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	if err := database.AddTrackerRegion(id, r.Id, time.Now().Unix()); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// @Summary      Remove region from tracker
+// @Description  Delete region from a connected JT808 tracker
+// @Tags         Regions
+// @Produce      json
+// @Param        id         path      string  true  "TrackerID"
+// @Param        regionId   path      int     true  "RegionID"
+// @Success      200  {object}  StringResultRes "success"
+// @Failure      400  {object}  StringResultRes "invalid region id OR API key required OR Only supported by JT808 trackers"
+// @Failure      401  {object}  StringResultRes "Invalid API key OR not allowed to access tracker OR You don't have a region with the specified id"
+// @Failure      500  {object}  StringResultRes "failed"
+// @Failure      502  {object}  StringResultRes "Invalid response from tracker OR The tracker rejected the request"
+// @Failure      503  {object}  StringResultRes "The tracker is not connected"
+// @Failure      504  {object}  StringResultRes "The tracker did not respond"
+// @Router       /trackers/{id}/regions/{regionId} [delete]
+// @Security     ApiKeyAuth
+func removeTrackerRegion(c *gin.Context) {
+	id := c.Param("id")
+	r := c.MustGet("region").(model.Region)
+	if !requireJT808Connected(c, id) {
+		return
+	}
+	msgType, body, err := jt808.EncodeDeleteRegions(r.Type, []uint32{uint32(r.Id)})
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "invalid region: " + err.Error()})
+		return
+	}
+	p, ok := sendTrackerMsg(c, id, msgType, body)
+	if !ok {
+		return
+	}
+	if !requireUniversalSuccess(c, p) {
+		return
+	}
+	if err := database.RemoveTrackerRegion(id, r.Id); err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"result": "failed"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"result": "success"})
+}
+
+// Get region if it is owned by caller or if caller is admin
+// Responds with an error and returns false if not
+func getAccessibleRegion(c *gin.Context, id int) (model.Region, bool) {
+	r, err := database.GetRegion(id)
+	if err != nil || (r.Owner != c.GetInt("userId") && !c.GetBool("isadmin")) {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"result": "You don't have a region with the specified id"})
+		return r, false
+	}
+	return r, true
+}
+
+// Convert a model.Region struct to a RegionResponse object
+func newRegionResponse(r model.Region) RegionResponse {
+	return RegionResponse{
+		Id:                r.Id,
+		Owner:             r.Owner,
+		Name:              r.Name,
+		Type:              r.Type,
+		Points:            r.Points,
+		Radius:            r.Radius,
+		Width:             r.Width,
+		MaxSpeed:          r.MaxSpeed,
+		OverspeedDuration: r.OverspeedDuration,
+		AlarmOnEnter:      r.AlarmOnEnter,
+		AlarmOnExit:       r.AlarmOnExit,
+	}
+}
+
+// @Summary      Whoami
+// @Description  Fetch the user/organization name associated with the used API key. This can be used to detect if a api-key is valid
+// @Tags         Authentication
+// @Produce      json
+// @Success      200  {object}  NameRes "NAME OF USER/ORGANISATION"
+// @Failure      400  {object}  StringResultRes "API key required"
+// @Failure      401  {object}  StringResultRes "Invalid API key"
+// @Router       /whoami [get]
+// @Security     ApiKeyAuth
+func whoami(c *gin.Context) {
+	name := c.GetString("name")
+	c.IndentedJSON(http.StatusOK, gin.H{"name": name})
+}
+
+// Misc
+func timeToString(t int64) string {
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
+
+func getActiveHandlersId() []string {
+	tm.Mu.Lock()
+	keys := maps.Keys(tm.Handlers)
+	tm.Mu.Unlock()
+	return slices.Collect(keys)
+}
+
+// Get handler of tracker if it is connected
+func getActiveHandler(id string) (*model.TrackerHandler, bool) {
+	tm.Mu.Lock()
+	defer tm.Mu.Unlock()
+	handler, ok := tm.Handlers[id]
+	return handler, ok
+}
+
+// Respond with an error and return false unless tracker is connected using JT808
+func requireJT808Connected(c *gin.Context, id string) bool {
+	handler, ok := getActiveHandler(id)
+	if !ok {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"result": "The tracker is not connected"})
+		return false
+	}
+	if handler.Protocol != utils.ProtocolTypeJT808 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"result": "Only supported by JT808 trackers"})
+		return false
+	}
+	return true
+}
+
+// Send protocol specific message to tracker and wait for the response packet
+// Responds with an error and returns false if the tracker could not be reached
+func sendTrackerMsg(c *gin.Context, id string, msgType uint16, body []byte) (model.Packet, bool) {
+	// Buffered, so the tracker handler is not blocked if the request has timed out
+	resultChannel := make(chan model.CommandResult, 1)
+	tm.CommandQueue <- model.TrackerCommand{TrackerId: id, MsgType: msgType, Body: body, Result: resultChannel}
+	select {
+	case res := <-resultChannel:
+		if errors.Is(res.Err, jt808.ErrSubPackageBusy) {
+			c.IndentedJSON(http.StatusConflict, gin.H{"result": "Another sub-packaged message is being sent to the tracker"})
+			return res.Packet, false
+		}
+		if res.Err != nil {
+			c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"result": "The tracker is not connected"})
+			return res.Packet, false
+		}
+		return res.Packet, true
+	case <-time.After(commandTimeout):
+		c.IndentedJSON(http.StatusGatewayTimeout, gin.H{"result": "The tracker did not respond"})
+		return model.Packet{}, false
+	}
+}
+
+// Send firmware upgrade to tracker as sub-packages, and update upgrade u as packages are acknowledged
+// The upgrade is failed if the tracker rejects a package or stops responding
+func runFirmwareUpgrade(u model.FirmwareUpgrade, body []byte) {
+	// Buffered, so the tracker handler is not blocked
+	resultChannel := make(chan model.CommandResult, 1)
+	progressChannel := make(chan int, 1)
+	tm.CommandQueue <- model.TrackerCommand{TrackerId: u.TrackerId, MsgType: jt808.MsgTypeUpgrade, Body: body, Result: resultChannel, Progress: progressChannel}
+	timer := time.NewTimer(commandTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case sent := <-progressChannel:
+			u.SentPackages = sent
+			if err := database.UpdateFirmwareUpgrade(u.Id, u.Status, u.SentPackages, time.Now().Unix()); err != nil {
+				log.Println(err)
+			}
+			timer.Reset(commandTimeout)
+			continue
+		case res := <-resultChannel:
+			_, _, result, err := jt808.ParseUniversalRes(res.Packet.Payload)
+			if res.Err != nil || res.Packet.PacketType != jt808.MsgTypeTermUniversalRes || err != nil || result != jt808.ResultSuccess {
+				log.Printf("%v: Firmware upgrade %v failed after %v of %v packages\n", u.TrackerId, u.Id, u.SentPackages, u.TotalPackages)
+				u.Status = model.FirmwareUpgradeFailed
+			} else {
+				u.Status = model.FirmwareUpgradeSent
+				u.SentPackages = u.TotalPackages
+			}
+		case <-timer.C:
+			log.Printf("%v: Firmware upgrade %v timed out after %v of %v packages\n", u.TrackerId, u.Id, u.SentPackages, u.TotalPackages)
+			u.Status = model.FirmwareUpgradeFailed
+		}
+		if err := database.UpdateFirmwareUpgrade(u.Id, u.Status, u.SentPackages, time.Now().Unix()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+}
+
+// Respond with an error and return false unless p is a universal response indicating success
+func requireUniversalSuccess(c *gin.Context, p model.Packet) bool {
+	if p.PacketType != jt808.MsgTypeTermUniversalRes {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "Invalid response from tracker"})
+		return false
+	}
+	_, _, result, err := jt808.ParseUniversalRes(p.Payload)
+	if err != nil || result != jt808.ResultSuccess {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{"result": "The tracker rejected the request"})
+		return false
+	}
+	return true
+}
+
+// parseTimeRangeQuery reads the optional ?start and ?end query parameters.
+// end defaults to now and start defaults to 24 hours before end.
+func parseTimeRangeQuery(c *gin.Context) (int64, int64, error) {
+	var start, end int64
+	var err error
+	if endQ := c.Query("end"); endQ == "" {
+		end = time.Now().Unix()
+	} else if end, err = parseTimeQuery(endQ); err != nil {
+		return 0, 0, fmt.Errorf("invalid end parameter")
+	}
+	if startQ := c.Query("start"); startQ == "" {
+		start = end - 24*3600
+	} else if start, err = parseTimeQuery(startQ); err != nil {
+		return 0, 0, fmt.Errorf("invalid start parameter")
+	}
+	return start, end, nil
 }
 
 // parseTimeQuery parses either RFC3339 string or unix seconds into epoch seconds
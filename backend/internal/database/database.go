@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"banjo.dev/trackerr/internal/model"
 	_ "github.com/mattn/go-sqlite3"
@@ -14,6 +17,8 @@ const file string = "database.db"
 
 var db *sql.DB
 var submap map[string]string
+var mediaDir string = "media"
+var firmwareDir string = "firmware"
 
 type Repository interface {
 	VerifyAPIKey(key string) bool
@@ -21,17 +26,28 @@ type Repository interface {
 	GetTrackerLocationHistory(trackerID string) []model.Locationdata
 }
 
+// Columns selected for location records, in the order expected by scanLocation
+const locationColumns = "id,trackerId,timestamp,receivedAt,lat,lon,speed,heading,historic,altitude,alarmFlags,status,mileage,fuel,recorderSpeed,signalStrength,satellites,additionalInfo,driverId"
+
+// Scan a row of locationColumns into a Locationdata struct
+func scanLocation(row interface{ Scan(...any) error }) (model.Locationdata, error) {
+	var i model.Locationdata
+	err := row.Scan(&i.EntryId, &i.TrackerId, &i.Timestamp, &i.ReceivedAt, &i.Lat, &i.Lon, &i.Speed, &i.Heading, &i.Historic,
+		&i.Altitude, &i.AlarmFlags, &i.Status, &i.Mileage, &i.Fuel, &i.RecorderSpeed, &i.SignalStrength, &i.Satellites, &i.AdditionalInfo, &i.DriverId)
+	return i, err
+}
+
 func GetTrackerLocationHistory(trackerID string) ([]model.Locationdata, error) {
 	var ld []model.Locationdata
 	// Create and run SQL query
-	rows, err := db.Query("SELECT * FROM location_data WHERE trackerId = ?", trackerID)
+	rows, err := db.Query("SELECT "+locationColumns+" FROM location_data WHERE trackerId = ?", trackerID)
 	if err != nil {
 		return ld, fmt.Errorf("no history found for tracker:%v", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var i model.Locationdata
-		if err := rows.Scan(&i.EntryId, &i.TrackerId, &i.Timestamp, &i.Lat, &i.Lon, &i.Speed, &i.Heading); err != nil {
+		i, err := scanLocation(rows)
+		if err != nil {
 			log.Fatal(err)
 		}
 		log.Printf("ID:%v, Tracker: %v, Lat:%v, Lon:%v\n", i.EntryId, i.TrackerId, i.Lat, i.Lon)
@@ -50,16 +66,17 @@ func GetTrackerLocationHistoryRange(trackerID string, start int64, end int64) ([
 		start = end
 		end = tmp
 	}
+	query := "SELECT " + locationColumns + " FROM location_data WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp ASC"
 	// Print query for debugging
-	log.Printf("Executing query: SELECT id,trackerId,timestamp,lat,lon,speed,heading FROM location_data WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp ASC", trackerID, start, end)
-	rows, err := db.Query("SELECT id,trackerId,timestamp,lat,lon,speed,heading FROM location_data WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp ASC", trackerID, start, end)
+	log.Println("Executing query:", query, trackerID, start, end)
+	rows, err := db.Query(query, trackerID, start, end)
 	if err != nil {
 		return ld, fmt.Errorf("no history found for tracker: %v", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var i model.Locationdata
-		if err := rows.Scan(&i.EntryId, &i.TrackerId, &i.Timestamp, &i.Lat, &i.Lon, &i.Speed, &i.Heading); err != nil {
+		i, err := scanLocation(rows)
+		if err != nil {
 			log.Fatal(err)
 		}
 		ld = append(ld, i)
@@ -72,14 +89,14 @@ func GetTrackerLocationHistoryRange(trackerID string, start int64, end int64) ([
 func GetTrackerLocationHistoryLimit(trackerID string, limit int) ([]model.Locationdata, error) {
 	var ld []model.Locationdata
 	// Create and run SQL query - order by timestamp descending and limit the number of rows
-	rows, err := db.Query("SELECT id,trackerId,timestamp,lat,lon,speed,heading FROM location_data WHERE trackerId = ? ORDER BY timestamp DESC LIMIT ?", trackerID, limit)
+	rows, err := db.Query("SELECT "+locationColumns+" FROM location_data WHERE trackerId = ? ORDER BY timestamp DESC LIMIT ?", trackerID, limit)
 	if err != nil {
 		return ld, fmt.Errorf("no history found for tracker:%v", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var i model.Locationdata
-		if err := rows.Scan(&i.EntryId, &i.TrackerId, &i.Timestamp, &i.Lat, &i.Lon, &i.Speed, &i.Heading); err != nil {
+		i, err := scanLocation(rows)
+		if err != nil {
 			log.Fatal(err)
 		}
 		ld = append(ld, i)
@@ -88,10 +105,10 @@ func GetTrackerLocationHistoryLimit(trackerID string, limit int) ([]model.Locati
 }
 
 func GetLocation(TrackerID string) (model.Locationdata, error) {
-	var ld model.Locationdata
 	// Create and run SQL query
-	row := db.QueryRow("SELECT timestamp,lat,lon,speed,heading FROM location_data WHERE trackerId = ? ORDER BY timestamp DESC LIMIT 1", TrackerID)
-	if err := row.Scan(&ld.Timestamp, &ld.Lat, &ld.Lon, &ld.Speed, &ld.Heading); err != nil {
+	row := db.QueryRow("SELECT "+locationColumns+" FROM location_data WHERE trackerId = ? ORDER BY timestamp DESC LIMIT 1", TrackerID)
+	ld, err := scanLocation(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return ld, fmt.Errorf("no location entry found for tracker: %v", err)
 		}
@@ -102,13 +119,165 @@ func GetLocation(TrackerID string) (model.Locationdata, error) {
 
 func InsertLocationRecord(ld model.Locationdata) error {
 	// Create and run SQL query
-	_, err := db.Exec("INSERT INTO location_data (trackerId,timestamp,lat,lon,speed,heading) VALUES (?,?,?,?,?,?)", ld.TrackerId, ld.Timestamp, ld.Lat, ld.Lon, ld.Speed, ld.Heading)
+	_, err := db.Exec("INSERT INTO location_data (trackerId,timestamp,receivedAt,lat,lon,speed,heading,historic,altitude,alarmFlags,status,mileage,fuel,recorderSpeed,signalStrength,satellites,additionalInfo,driverId) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		ld.TrackerId, ld.Timestamp, ld.ReceivedAt, ld.Lat, ld.Lon, ld.Speed, ld.Heading, ld.Historic,
+		ld.Altitude, ld.AlarmFlags, ld.Status, ld.Mileage, ld.Fuel, ld.RecorderSpeed, ld.SignalStrength, ld.Satellites, ld.AdditionalInfo, ld.DriverId)
 	if err != nil {
 		return fmt.Errorf("failed to insert location record: %v", err)
 	}
 	return nil
 }
 
+// Terminal status
+func InsertTerminalStatus(ts model.TerminalStatus) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO terminal_status (trackerId,timestamp,oilCut,gpsTracking,alarm,charging,acc,defense,voltageLevel,externalVoltage,gsmSignal) VALUES (?,?,?,?,?,?,?,?,?,?,?)", ts.TrackerId, ts.Timestamp, ts.OilCut, ts.GPSTracking, ts.Alarm, ts.Charging, ts.ACC, ts.Defense, ts.VoltageLevel, ts.ExternalVoltage, ts.GSMSignal)
+	if err != nil {
+		return fmt.Errorf("failed to insert terminal status: %v", err)
+	}
+	return nil
+}
+
+// GetTerminalStatus returns the latest terminal status reported by trackerID
+func GetTerminalStatus(trackerID string) (model.TerminalStatus, error) {
+	var ts model.TerminalStatus
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id,trackerId,timestamp,oilCut,gpsTracking,alarm,charging,acc,defense,voltageLevel,externalVoltage,gsmSignal FROM terminal_status WHERE trackerId = ? ORDER BY timestamp DESC LIMIT 1", trackerID)
+	if err := row.Scan(&ts.EntryId, &ts.TrackerId, &ts.Timestamp, &ts.OilCut, &ts.GPSTracking, &ts.Alarm, &ts.Charging, &ts.ACC, &ts.Defense, &ts.VoltageLevel, &ts.ExternalVoltage, &ts.GSMSignal); err != nil {
+		if err == sql.ErrNoRows {
+			return ts, fmt.Errorf("no terminal status found for tracker: %v", err)
+		}
+		log.Fatal(err)
+	}
+	return ts, nil
+}
+
+// GetTerminalStatusHistoryRange returns terminal status records between [start,end] (inclusive)
+// start and end are Unix seconds. Results are ordered by timestamp ascending.
+func GetTerminalStatusHistoryRange(trackerID string, start int64, end int64) ([]model.TerminalStatus, error) {
+	var history []model.TerminalStatus
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	rows, err := db.Query("SELECT id,trackerId,timestamp,oilCut,gpsTracking,alarm,charging,acc,defense,voltageLevel,externalVoltage,gsmSignal FROM terminal_status WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp ASC", trackerID, start, end)
+	if err != nil {
+		return history, fmt.Errorf("no terminal status history found for tracker: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts model.TerminalStatus
+		if err := rows.Scan(&ts.EntryId, &ts.TrackerId, &ts.Timestamp, &ts.OilCut, &ts.GPSTracking, &ts.Alarm, &ts.Charging, &ts.ACC, &ts.Defense, &ts.VoltageLevel, &ts.ExternalVoltage, &ts.GSMSignal); err != nil {
+			log.Fatal(err)
+		}
+		history = append(history, ts)
+	}
+	return history, nil
+}
+
+// Alarms
+func InsertAlarm(a model.Alarm) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO alarms (trackerId,timestamp,type,name,lat,lon,serialNumber) VALUES (?,?,?,?,?,?,?)", a.TrackerId, a.Timestamp, a.Type, a.Name, a.Lat, a.Lon, a.SerialNumber)
+	if err != nil {
+		return fmt.Errorf("failed to insert alarm: %v", err)
+	}
+	return nil
+}
+
+// GetTrackerAlarms returns alarms raised by trackerID between [start,end] (inclusive), ordered by timestamp ascending.
+func GetTrackerAlarms(trackerID string, start int64, end int64) ([]model.Alarm, error) {
+	return GetAlarmsByFilter(" AND a.trackerId = ?", []interface{}{trackerID}, start, end)
+}
+
+// GetAlarms returns alarms raised by all trackers between [start,end] (inclusive)
+func GetAlarms(start int64, end int64) ([]model.Alarm, error) {
+	return GetAlarmsByFilter("", nil, start, end)
+}
+
+// GetAlarmsByUserId returns alarms raised by trackers owned by userId between [start,end] (inclusive)
+func GetAlarmsByUserId(userId int, start int64, end int64) ([]model.Alarm, error) {
+	return GetAlarmsByFilter(" AND t.owner = ?", []interface{}{userId}, start, end)
+}
+
+func GetAlarmsByFilter(whereClause string, args []interface{}, start int64, end int64) ([]model.Alarm, error) {
+	var alarms []model.Alarm
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	args = append([]interface{}{start, end}, args...)
+	// Create and run SQL query. Query joins trackers to allow filtering by owner
+	rows, err := db.Query("SELECT a.id, a.trackerId, a.timestamp, a.type, a.name, a.lat, a.lon, a.serialNumber, a.acknowledgedBy, a.acknowledgedAt FROM alarms AS a INNER JOIN trackers AS t ON t.id = a.trackerId WHERE a.timestamp >= ? AND a.timestamp <= ?"+whereClause+" ORDER BY a.timestamp ASC", args...)
+	if err != nil {
+		return alarms, fmt.Errorf("failed to fetch alarms: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a model.Alarm
+		if err := rows.Scan(&a.EntryId, &a.TrackerId, &a.Timestamp, &a.Type, &a.Name, &a.Lat, &a.Lon, &a.SerialNumber, &a.AcknowledgedBy, &a.AcknowledgedAt); err != nil {
+			log.Fatal(err)
+		}
+		alarms = append(alarms, a)
+	}
+	return alarms, nil
+}
+
+// GetAlarm returns alarm entryId raised by trackerID
+func GetAlarm(trackerID string, entryId int) (model.Alarm, error) {
+	var a model.Alarm
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id, trackerId, timestamp, type, name, lat, lon, serialNumber, acknowledgedBy, acknowledgedAt FROM alarms WHERE trackerId = ? AND id = ?", trackerID, entryId)
+	if err := row.Scan(&a.EntryId, &a.TrackerId, &a.Timestamp, &a.Type, &a.Name, &a.Lat, &a.Lon, &a.SerialNumber, &a.AcknowledgedBy, &a.AcknowledgedAt); err != nil {
+		return a, fmt.Errorf("requested alarm was not found")
+	}
+	return a, nil
+}
+
+// AcknowledgeAlarm records that userId acknowledged alarm entryId at acknowledgedAt
+func AcknowledgeAlarm(entryId uint64, userId int, acknowledgedAt int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE alarms SET acknowledgedBy = ?, acknowledgedAt = ? WHERE id = ?", userId, acknowledgedAt, entryId)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge alarm %v: %v", entryId, err)
+	}
+	return nil
+}
+
+// Tracking sessions
+func InsertTrackingSession(ts model.TrackingSession) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO tracking_sessions (trackerId,userId,startedAt,interval,expiresAt) VALUES (?,?,?,?,?)", ts.TrackerId, ts.UserId, ts.StartedAt, ts.Interval, ts.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert tracking session: %v", err)
+	}
+	return nil
+}
+
+// GetActiveTrackingSession returns the latest tracking session of trackerID which has not expired at now
+func GetActiveTrackingSession(trackerID string, now int64) (model.TrackingSession, error) {
+	var ts model.TrackingSession
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id,trackerId,userId,startedAt,interval,expiresAt FROM tracking_sessions WHERE trackerId = ? AND expiresAt > ? ORDER BY startedAt DESC LIMIT 1", trackerID, now)
+	if err := row.Scan(&ts.EntryId, &ts.TrackerId, &ts.UserId, &ts.StartedAt, &ts.Interval, &ts.ExpiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return ts, fmt.Errorf("no active tracking session for tracker %v", trackerID)
+		}
+		log.Fatal(err)
+	}
+	return ts, nil
+}
+
+// StopTrackingSessions expires all active tracking sessions of trackerID at now
+func StopTrackingSessions(trackerID string, now int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE tracking_sessions SET expiresAt = ? WHERE trackerId = ? AND expiresAt > ?", now, trackerID, now)
+	if err != nil {
+		return fmt.Errorf("failed to stop tracking sessions of %v: %v", trackerID, err)
+	}
+	return nil
+}
+
 // Users
 func GetUserByAPIKey(apikey string) (model.User, error) {
 	var user model.User
@@ -136,6 +305,14 @@ func GetTrackersByUserAndTrackerId(userId int, trackerId string) []model.Tracker
 	return GetTrackersByFilter(" WHERE t.owner = ? AND t.id = ?", []interface{}{userId, trackerId})
 }
 
+func GetTrackersByICCID(iccid string) []model.TrackerWithLocation {
+	return GetTrackersByFilter(" WHERE t.iccid = ?", []interface{}{iccid})
+}
+
+func GetTrackersByUserAndICCID(userId int, iccid string) []model.TrackerWithLocation {
+	return GetTrackersByFilter(" WHERE t.owner = ? AND t.iccid = ?", []interface{}{userId, iccid})
+}
+
 func GetTrackerByName(name string) (model.TrackerWithLocation, error) {
 	trackers := GetTrackersByFilter(" WHERE t.name = ?", []interface{}{name})
 	if len(trackers) == 0 {
@@ -155,8 +332,8 @@ func GetTracker(TrackerID string) (model.TrackerWithLocation, error) {
 
 func GetTrackersByFilter(whereClause string, args []interface{}) []model.TrackerWithLocation {
 	var t []model.TrackerWithLocation
-	// Create and run SQL query. Query joins each tracker with latest associated location data
-	rows, err := db.Query("WITH latest_ld AS ( SELECT trackerId, timestamp, lat, lon, speed, heading, ROW_NUMBER() OVER ( PARTITION BY trackerId ORDER BY timestamp DESC ) AS rn FROM location_data ) SELECT t.id, t.name, t.owner, t.phoneNumber, t.model, t.enabled, t.lastConnected, ld.timestamp, ld.lat, ld.lon, ld.speed, ld.heading FROM trackers AS t LEFT JOIN latest_ld AS ld ON ld.trackerId = t.id AND ld.rn = 1"+whereClause, args...)
+	// Create and run SQL query. Query joins each tracker with latest associated location data, terminal status and registration
+	rows, err := db.Query("WITH latest_ld AS ( SELECT trackerId, timestamp, receivedAt, lat, lon, speed, heading, ROW_NUMBER() OVER ( PARTITION BY trackerId ORDER BY timestamp DESC ) AS rn FROM location_data ), latest_ts AS ( SELECT *, ROW_NUMBER() OVER ( PARTITION BY trackerId ORDER BY timestamp DESC ) AS rn FROM terminal_status ) SELECT t.id, t.name, t.owner, t.phoneNumber, t.model, t.enabled, t.lastConnected, t.imsi, t.iccid, ld.timestamp, ld.receivedAt, ld.lat, ld.lon, ld.speed, ld.heading, ts.timestamp, ts.oilCut, ts.gpsTracking, ts.alarm, ts.charging, ts.acc, ts.defense, ts.voltageLevel, ts.externalVoltage, ts.gsmSignal, r.timestamp, r.provinceId, r.cityId, r.manufacturerId, r.terminalModel, r.terminalId, r.plateColour, r.plateNumber FROM trackers AS t LEFT JOIN latest_ld AS ld ON ld.trackerId = t.id AND ld.rn = 1 LEFT JOIN latest_ts AS ts ON ts.trackerId = t.id AND ts.rn = 1 LEFT JOIN jt808_registrations AS r ON r.trackerId = t.id"+whereClause, args...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -164,18 +341,30 @@ func GetTrackersByFilter(whereClause string, args []interface{}) []model.Tracker
 	for rows.Next() {
 		var twl model.TrackerWithLocation
 		var timestamp *int64
-		var lat *uint32
-		var lon *uint32
+		var receivedAt *int64
+		var lat *int32
+		var lon *int32
 		var speed *uint16
 		var heading *uint16
-		// Scan tracker data into twl and location data into seperate variables
-		if err := rows.Scan(&twl.Tracker.Id, &twl.Name, &twl.Owner, &twl.PhoneNumber, &twl.Model, &twl.Enabled, &twl.LastConnected, &timestamp, &lat, &lon, &speed, &heading); err != nil {
+		var tsTimestamp *int64
+		var oilCut, gpsTracking, charging, acc, defense *bool
+		var alarm, voltageLevel, gsmSignal *uint8
+		var externalVoltage *uint16
+		var regTimestamp *int64
+		var provinceId, cityId *uint16
+		var manufacturerId, terminalModel, terminalId, plateNumber *string
+		var plateColour *uint8
+		// Scan tracker data into twl and location data, terminal status and registration into seperate variables
+		if err := rows.Scan(&twl.Tracker.Id, &twl.Name, &twl.Owner, &twl.PhoneNumber, &twl.Model, &twl.Enabled, &twl.LastConnected, &twl.IMSI, &twl.ICCID, &timestamp, &receivedAt, &lat, &lon, &speed, &heading,
+			&tsTimestamp, &oilCut, &gpsTracking, &alarm, &charging, &acc, &defense, &voltageLevel, &externalVoltage, &gsmSignal,
+			&regTimestamp, &provinceId, &cityId, &manufacturerId, &terminalModel, &terminalId, &plateColour, &plateNumber); err != nil {
 			log.Fatal(err)
 		}
 		// If tracker has location data, then create and append location data to twl
 		if timestamp != nil {
 			var locationdata model.Locationdata
 			locationdata.Timestamp = *timestamp
+			locationdata.ReceivedAt = *receivedAt
 			locationdata.Lat = *lat
 			locationdata.Lon = *lon
 			locationdata.Speed = *speed
@@ -184,6 +373,36 @@ func GetTrackersByFilter(whereClause string, args []interface{}) []model.Tracker
 		} else {
 			twl.Ld = nil
 		}
+		// If tracker has reported terminal status, then create and append it to twl
+		if tsTimestamp != nil {
+			twl.Status = &model.TerminalStatus{
+				TrackerId:       twl.Tracker.Id,
+				Timestamp:       *tsTimestamp,
+				OilCut:          *oilCut,
+				GPSTracking:     *gpsTracking,
+				Alarm:           *alarm,
+				Charging:        *charging,
+				ACC:             *acc,
+				Defense:         *defense,
+				VoltageLevel:    *voltageLevel,
+				ExternalVoltage: *externalVoltage,
+				GSMSignal:       *gsmSignal,
+			}
+		}
+		// If tracker has registered using JT808, then create and append registration to twl
+		if regTimestamp != nil {
+			twl.Registration = &model.Registration{
+				TrackerId:      twl.Tracker.Id,
+				Timestamp:      *regTimestamp,
+				ProvinceId:     *provinceId,
+				CityId:         *cityId,
+				ManufacturerId: *manufacturerId,
+				TerminalModel:  *terminalModel,
+				TerminalId:     *terminalId,
+				PlateColour:    *plateColour,
+				PlateNumber:    *plateNumber,
+			}
+		}
 		t = append(t, twl)
 	}
 	return t
@@ -278,6 +497,577 @@ func UpdateLastConnected(TrackerID string, timestamp int64) error {
 	return nil
 }
 
+func UpdateIMSI(TrackerID string, imsi string) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE trackers SET imsi = ? WHERE id = ?", imsi, TrackerID)
+	if err != nil {
+		return fmt.Errorf("failed to update imsi of %v: %v", TrackerID, err)
+	}
+	return nil
+}
+
+func UpdateICCID(TrackerID string, iccid string) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE trackers SET iccid = ? WHERE id = ?", iccid, TrackerID)
+	if err != nil {
+		return fmt.Errorf("failed to update iccid of %v: %v", TrackerID, err)
+	}
+	return nil
+}
+
+// Media
+// SaveMedia writes data to a file in the media directory of the tracker and stores m with the path of the file
+func SaveMedia(m model.Media, data []byte, extension string) (model.Media, error) {
+	dir := filepath.Join(mediaDir, m.TrackerId)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return m, fmt.Errorf("failed to create media directory: %v", err)
+	}
+	m.Path = filepath.Join(dir, fmt.Sprintf("%d_%d.%s", m.MediaId, m.ReceivedAt, extension))
+	m.Size = len(data)
+	if err := os.WriteFile(m.Path, data, 0640); err != nil {
+		return m, fmt.Errorf("failed to write media file: %v", err)
+	}
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO media (trackerId,mediaId,timestamp,receivedAt,type,format,event,channel,lat,lon,alarmFlags,path,size) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)",
+		m.TrackerId, m.MediaId, m.Timestamp, m.ReceivedAt, m.Type, m.Format, m.Event, m.Channel, m.Lat, m.Lon, m.AlarmFlags, m.Path, m.Size)
+	if err != nil {
+		return m, fmt.Errorf("failed to insert media: %v", err)
+	}
+	return m, nil
+}
+
+// GetTrackerMediaByFilter returns media of trackerID between [start,end] (inclusive), ordered by timestamp ascending
+func GetTrackerMediaByFilter(trackerID string, whereClause string, args []interface{}, start int64, end int64) ([]model.Media, error) {
+	var media []model.Media
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	args = append([]interface{}{trackerID, start, end}, args...)
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,trackerId,mediaId,timestamp,receivedAt,type,format,event,channel,lat,lon,alarmFlags,path,size FROM media WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ?"+whereClause+" ORDER BY timestamp ASC", args...)
+	if err != nil {
+		return media, fmt.Errorf("failed to fetch media: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m model.Media
+		if err := rows.Scan(&m.EntryId, &m.TrackerId, &m.MediaId, &m.Timestamp, &m.ReceivedAt, &m.Type, &m.Format, &m.Event, &m.Channel, &m.Lat, &m.Lon, &m.AlarmFlags, &m.Path, &m.Size); err != nil {
+			log.Fatal(err)
+		}
+		media = append(media, m)
+	}
+	return media, nil
+}
+
+func GetTrackerMedia(trackerID string, start int64, end int64) ([]model.Media, error) {
+	return GetTrackerMediaByFilter(trackerID, "", nil, start, end)
+}
+
+// GetMedia returns the media entry with entryID uploaded by trackerID
+func GetMedia(trackerID string, entryID int) (model.Media, error) {
+	var m model.Media
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id,trackerId,mediaId,timestamp,receivedAt,type,format,event,channel,lat,lon,alarmFlags,path,size FROM media WHERE trackerId = ? AND id = ?", trackerID, entryID)
+	if err := row.Scan(&m.EntryId, &m.TrackerId, &m.MediaId, &m.Timestamp, &m.ReceivedAt, &m.Type, &m.Format, &m.Event, &m.Channel, &m.Lat, &m.Lon, &m.AlarmFlags, &m.Path, &m.Size); err != nil {
+		if err == sql.ErrNoRows {
+			return m, fmt.Errorf("media not found")
+		}
+		log.Fatal(err)
+	}
+	return m, nil
+}
+
+// Drivers
+// SaveDriver stores driver d, updating the details of an existing driver with the same certificate, and returns the id of the driver
+func SaveDriver(d model.Driver) (int, error) {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO drivers (name,certificate,agency,certificateExpiry,idNumber,lastSeen) VALUES (?,?,?,?,?,?) ON CONFLICT(certificate) DO UPDATE SET name = excluded.name, agency = excluded.agency, certificateExpiry = excluded.certificateExpiry, idNumber = excluded.idNumber, lastSeen = excluded.lastSeen",
+		d.Name, d.Certificate, d.Agency, d.CertificateExpiry, d.IdNumber, d.LastSeen)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save driver: %v", err)
+	}
+	var id int
+	if err := db.QueryRow("SELECT id FROM drivers WHERE certificate = ?", d.Certificate).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get id of driver: %v", err)
+	}
+	return id, nil
+}
+
+func GetDriversByFilter(whereClause string, args []interface{}) []model.Driver {
+	var drivers []model.Driver
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,name,certificate,agency,certificateExpiry,idNumber,lastSeen FROM drivers"+whereClause+" ORDER BY id ASC", args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d model.Driver
+		if err := rows.Scan(&d.Id, &d.Name, &d.Certificate, &d.Agency, &d.CertificateExpiry, &d.IdNumber, &d.LastSeen); err != nil {
+			log.Fatal(err)
+		}
+		drivers = append(drivers, d)
+	}
+	return drivers
+}
+
+func GetDrivers() []model.Driver {
+	return GetDriversByFilter("", nil)
+}
+
+// GetDriversByUserId returns drivers who have driven trackers owned by userId
+func GetDriversByUserId(userId int) []model.Driver {
+	return GetDriversByFilter(" WHERE id IN (SELECT trips.driverId FROM trips INNER JOIN trackers ON trackers.id = trips.trackerId WHERE trackers.owner = ?)", []interface{}{userId})
+}
+
+func GetDriver(id int) (model.Driver, error) {
+	drivers := GetDriversByFilter(" WHERE id = ?", []interface{}{id})
+	if len(drivers) != 1 {
+		return model.Driver{}, fmt.Errorf("requested driver was not found")
+	}
+	return drivers[0], nil
+}
+
+// StartTrip ends the open trip of trackerID, and starts a trip of driverId at startedAt
+func StartTrip(driverId int, trackerID string, startedAt int64) error {
+	if err := EndTrips(trackerID, startedAt); err != nil {
+		return err
+	}
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO trips (driverId,trackerId,startedAt) VALUES (?,?,?)", driverId, trackerID, startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to start trip: %v", err)
+	}
+	return nil
+}
+
+// EndTrips sets the end time of open trips of trackerID
+func EndTrips(trackerID string, endedAt int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE trips SET endedAt = ? WHERE trackerId = ? AND endedAt IS NULL", endedAt, trackerID)
+	if err != nil {
+		return fmt.Errorf("failed to end trips of %v: %v", trackerID, err)
+	}
+	return nil
+}
+
+// GetOpenTrip returns the trip of the driver currently logged in to trackerID
+func GetOpenTrip(trackerID string) (model.Trip, error) {
+	var tr model.Trip
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id,driverId,trackerId,startedAt,endedAt FROM trips WHERE trackerId = ? AND endedAt IS NULL ORDER BY startedAt DESC LIMIT 1", trackerID)
+	if err := row.Scan(&tr.Id, &tr.DriverId, &tr.TrackerId, &tr.StartedAt, &tr.EndedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return tr, fmt.Errorf("no open trip for tracker: %v", trackerID)
+		}
+		log.Fatal(err)
+	}
+	return tr, nil
+}
+
+// GetTripAt returns the trip of the driver logged in to trackerID at time ts
+func GetTripAt(trackerID string, ts int64) (model.Trip, error) {
+	var tr model.Trip
+	// Create and run SQL query
+	row := db.QueryRow("SELECT id,driverId,trackerId,startedAt,endedAt FROM trips WHERE trackerId = ? AND startedAt <= ? AND (endedAt IS NULL OR endedAt > ?) ORDER BY startedAt DESC LIMIT 1", trackerID, ts, ts)
+	if err := row.Scan(&tr.Id, &tr.DriverId, &tr.TrackerId, &tr.StartedAt, &tr.EndedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return tr, fmt.Errorf("no trip of tracker %v at %v", trackerID, ts)
+		}
+		log.Fatal(err)
+	}
+	return tr, nil
+}
+
+// GetDriverTripsByFilter returns trips of driverId overlapping [start,end] (inclusive), ordered by start time ascending
+func GetDriverTripsByFilter(driverId int, whereClause string, args []interface{}, start int64, end int64) ([]model.Trip, error) {
+	var trips []model.Trip
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	args = append([]interface{}{driverId, end, start}, args...)
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,driverId,trackerId,startedAt,endedAt FROM trips WHERE driverId = ? AND startedAt <= ? AND (endedAt IS NULL OR endedAt >= ?)"+whereClause+" ORDER BY startedAt ASC", args...)
+	if err != nil {
+		return trips, fmt.Errorf("failed to fetch trips: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tr model.Trip
+		if err := rows.Scan(&tr.Id, &tr.DriverId, &tr.TrackerId, &tr.StartedAt, &tr.EndedAt); err != nil {
+			log.Fatal(err)
+		}
+		trips = append(trips, tr)
+	}
+	return trips, nil
+}
+
+func GetDriverTrips(driverId int, start int64, end int64) ([]model.Trip, error) {
+	return GetDriverTripsByFilter(driverId, "", nil, start, end)
+}
+
+// GetDriverTripsByUserId returns trips of driverId in trackers owned by userId
+func GetDriverTripsByUserId(driverId int, userId int, start int64, end int64) ([]model.Trip, error) {
+	return GetDriverTripsByFilter(driverId, " AND trackerId IN (SELECT id FROM trackers WHERE owner = ?)", []interface{}{userId}, start, end)
+}
+
+// GetDriverLocationHistoryByFilter returns locations reported while driverId was logged in between [start,end] (inclusive), ordered by timestamp ascending
+func GetDriverLocationHistoryByFilter(driverId int, whereClause string, args []interface{}, start int64, end int64) ([]model.Locationdata, error) {
+	var ld []model.Locationdata
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	args = append([]interface{}{driverId, start, end}, args...)
+	// Create and run SQL query
+	rows, err := db.Query("SELECT "+locationColumns+" FROM location_data WHERE driverId = ? AND timestamp >= ? AND timestamp <= ?"+whereClause+" ORDER BY timestamp ASC", args...)
+	if err != nil {
+		return ld, fmt.Errorf("no history found for driver: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		i, err := scanLocation(rows)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ld = append(ld, i)
+	}
+	return ld, nil
+}
+
+func GetDriverLocationHistory(driverId int, start int64, end int64) ([]model.Locationdata, error) {
+	return GetDriverLocationHistoryByFilter(driverId, "", nil, start, end)
+}
+
+// GetDriverLocationHistoryByUserId returns locations of driverId reported by trackers owned by userId
+func GetDriverLocationHistoryByUserId(driverId int, userId int, start int64, end int64) ([]model.Locationdata, error) {
+	return GetDriverLocationHistoryByFilter(driverId, " AND trackerId IN (SELECT id FROM trackers WHERE owner = ?)", []interface{}{userId}, start, end)
+}
+
+// Passthrough data
+func InsertPassthroughData(d model.PassthroughData) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT INTO passthrough_data (trackerId,timestamp,type,data) VALUES (?,?,?,?)", d.TrackerId, d.Timestamp, d.Type, d.Data)
+	if err != nil {
+		return fmt.Errorf("failed to insert passthrough data: %v", err)
+	}
+	return nil
+}
+
+// GetTrackerPassthroughDataByFilter returns passthrough data of trackerID between [start,end] (inclusive), ordered by timestamp ascending
+func GetTrackerPassthroughDataByFilter(trackerID string, whereClause string, args []interface{}, start int64, end int64) ([]model.PassthroughData, error) {
+	var data []model.PassthroughData
+	// Ensure end >= start
+	if end < start {
+		start, end = end, start
+	}
+	args = append([]interface{}{trackerID, start, end}, args...)
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,trackerId,timestamp,type,data FROM passthrough_data WHERE trackerId = ? AND timestamp >= ? AND timestamp <= ?"+whereClause+" ORDER BY timestamp ASC", args...)
+	if err != nil {
+		return data, fmt.Errorf("failed to fetch passthrough data: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d model.PassthroughData
+		if err := rows.Scan(&d.EntryId, &d.TrackerId, &d.Timestamp, &d.Type, &d.Data); err != nil {
+			log.Fatal(err)
+		}
+		data = append(data, d)
+	}
+	return data, nil
+}
+
+func GetTrackerPassthroughData(trackerID string, start int64, end int64) ([]model.PassthroughData, error) {
+	return GetTrackerPassthroughDataByFilter(trackerID, "", nil, start, end)
+}
+
+func GetTrackerPassthroughDataByType(trackerID string, passthroughType uint8, start int64, end int64) ([]model.PassthroughData, error) {
+	return GetTrackerPassthroughDataByFilter(trackerID, " AND type = ?", []interface{}{passthroughType}, start, end)
+}
+
+// Firmware
+// SaveFirmware writes data to a file in the firmware directory and stores f with the path of the file
+func SaveFirmware(f model.Firmware, data []byte) (model.Firmware, error) {
+	if err := os.MkdirAll(firmwareDir, 0750); err != nil {
+		return f, fmt.Errorf("failed to create firmware directory: %v", err)
+	}
+	f.Path = filepath.Join(firmwareDir, fmt.Sprintf("%d.bin", time.Now().UnixNano()))
+	f.Size = len(data)
+	if err := os.WriteFile(f.Path, data, 0640); err != nil {
+		return f, fmt.Errorf("failed to write firmware file: %v", err)
+	}
+	// Create and run SQL query
+	res, err := db.Exec("INSERT INTO firmware (model,version,type,manufacturerId,path,size,uploadedAt) VALUES (?,?,?,?,?,?,?)",
+		f.Model, f.Version, f.Type, f.ManufacturerId, f.Path, f.Size, f.UploadedAt)
+	if err != nil {
+		os.Remove(f.Path)
+		return f, fmt.Errorf("failed to insert firmware: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return f, fmt.Errorf("failed to get id of firmware: %v", err)
+	}
+	f.Id = int(id)
+	return f, nil
+}
+
+func GetFirmwareByFilter(whereClause string, args []interface{}) []model.Firmware {
+	var firmware []model.Firmware
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,model,version,type,manufacturerId,path,size,uploadedAt FROM firmware"+whereClause+" ORDER BY id ASC", args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f model.Firmware
+		if err := rows.Scan(&f.Id, &f.Model, &f.Version, &f.Type, &f.ManufacturerId, &f.Path, &f.Size, &f.UploadedAt); err != nil {
+			log.Fatal(err)
+		}
+		firmware = append(firmware, f)
+	}
+	return firmware
+}
+
+func GetAllFirmware() []model.Firmware {
+	return GetFirmwareByFilter("", nil)
+}
+
+func GetFirmware(id int) (model.Firmware, error) {
+	firmware := GetFirmwareByFilter(" WHERE id = ?", []interface{}{id})
+	if len(firmware) != 1 {
+		return model.Firmware{}, fmt.Errorf("requested firmware was not found")
+	}
+	return firmware[0], nil
+}
+
+// DeleteFirmware removes firmware f and its file
+func DeleteFirmware(f model.Firmware) error {
+	// Create and run SQL query
+	_, err := db.Exec("DELETE FROM firmware WHERE id = ?", f.Id)
+	if err != nil {
+		return fmt.Errorf("failed to remove firmware from database: %v", err)
+	}
+	if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove firmware file: %v", err)
+	}
+	return nil
+}
+
+func CreateFirmwareUpgrade(u model.FirmwareUpgrade) (int, error) {
+	// Create and run SQL query
+	res, err := db.Exec("INSERT INTO firmware_upgrades (trackerId,firmwareId,startedAt,updatedAt,status,sentPackages,totalPackages) VALUES (?,?,?,?,?,?,?)",
+		u.TrackerId, u.FirmwareId, u.StartedAt, u.UpdatedAt, u.Status, u.SentPackages, u.TotalPackages)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create firmware upgrade: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of firmware upgrade: %v", err)
+	}
+	return int(id), nil
+}
+
+// UpdateFirmwareUpgrade updates upgrade id while it is being sent, so a result reported by the tracker is not overwritten
+func UpdateFirmwareUpgrade(id int, status string, sentPackages int, updatedAt int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE firmware_upgrades SET status = ?, sentPackages = ?, updatedAt = ? WHERE id = ? AND status = ?",
+		status, sentPackages, updatedAt, id, model.FirmwareUpgradeSending)
+	if err != nil {
+		return fmt.Errorf("failed to update firmware upgrade %v: %v", id, err)
+	}
+	return nil
+}
+
+// FailInterruptedFirmwareUpgrades marks upgrades which were being sent when the server stopped as failed,
+// since they are no longer sent to the tracker
+func FailInterruptedFirmwareUpgrades(updatedAt int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("UPDATE firmware_upgrades SET status = ?, updatedAt = ? WHERE status = ?",
+		model.FirmwareUpgradeFailed, updatedAt, model.FirmwareUpgradeSending)
+	if err != nil {
+		return fmt.Errorf("failed to fail interrupted firmware upgrades: %v", err)
+	}
+	return nil
+}
+
+// FinishFirmwareUpgrade sets status of the latest unfinished upgrade of trackerID
+func FinishFirmwareUpgrade(trackerID string, status string, updatedAt int64) error {
+	// Create and run SQL query
+	res, err := db.Exec("UPDATE firmware_upgrades SET status = ?, updatedAt = ? WHERE id = (SELECT id FROM firmware_upgrades WHERE trackerId = ? AND status IN (?,?) ORDER BY startedAt DESC LIMIT 1)",
+		status, updatedAt, trackerID, model.FirmwareUpgradeSending, model.FirmwareUpgradeSent)
+	if err != nil {
+		return fmt.Errorf("failed to finish firmware upgrade of %v: %v", trackerID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no unfinished firmware upgrade of %v", trackerID)
+	}
+	return nil
+}
+
+// GetFirmwareUpgrades returns the firmware upgrades of trackerID, ordered by start time ascending
+func GetFirmwareUpgrades(trackerID string) []model.FirmwareUpgrade {
+	var upgrades []model.FirmwareUpgrade
+	// Create and run SQL query
+	rows, err := db.Query("SELECT id,trackerId,firmwareId,startedAt,updatedAt,status,sentPackages,totalPackages FROM firmware_upgrades WHERE trackerId = ? ORDER BY startedAt ASC", trackerID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u model.FirmwareUpgrade
+		if err := rows.Scan(&u.Id, &u.TrackerId, &u.FirmwareId, &u.StartedAt, &u.UpdatedAt, &u.Status, &u.SentPackages, &u.TotalPackages); err != nil {
+			log.Fatal(err)
+		}
+		upgrades = append(upgrades, u)
+	}
+	return upgrades
+}
+
+// Regions
+const regionColumns = "r.id,r.owner,r.name,r.type,r.points,r.radius,r.width,r.maxSpeed,r.overspeedDuration,r.alarmOnEnter,r.alarmOnExit"
+
+func scanRegion(row interface{ Scan(...any) error }, extra ...any) (model.Region, error) {
+	var r model.Region
+	var points string
+	dest := append([]any{&r.Id, &r.Owner, &r.Name, &r.Type, &points, &r.Radius, &r.Width, &r.MaxSpeed, &r.OverspeedDuration, &r.AlarmOnEnter, &r.AlarmOnExit}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return r, err
+	}
+	r.Points = decodePoints(points)
+	return r, nil
+}
+
+// Points are stored as "lat,lon;lat,lon;..."
+func encodePoints(points []model.Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = fmt.Sprintf("%d,%d", p.Lat, p.Lon)
+	}
+	return strings.Join(parts, ";")
+}
+
+func decodePoints(s string) []model.Point {
+	var points []model.Point
+	for _, part := range strings.Split(s, ";") {
+		var p model.Point
+		if _, err := fmt.Sscanf(part, "%d,%d", &p.Lat, &p.Lon); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func CreateRegion(r model.Region) (int, error) {
+	// Create and run SQL query
+	res, err := db.Exec("INSERT INTO regions (owner,name,type,points,radius,width,maxSpeed,overspeedDuration,alarmOnEnter,alarmOnExit) VALUES (?,?,?,?,?,?,?,?,?,?)",
+		r.Owner, r.Name, r.Type, encodePoints(r.Points), r.Radius, r.Width, r.MaxSpeed, r.OverspeedDuration, r.AlarmOnEnter, r.AlarmOnExit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create region: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get id of region: %v", err)
+	}
+	return int(id), nil
+}
+
+func GetRegionsByFilter(whereClause string, args []interface{}) []model.Region {
+	var regions []model.Region
+	// Create and run SQL query
+	rows, err := db.Query("SELECT "+regionColumns+" FROM regions AS r"+whereClause+" ORDER BY r.id ASC", args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanRegion(rows)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+func GetRegions() []model.Region {
+	return GetRegionsByFilter("", nil)
+}
+
+func GetRegionsByOwner(owner int) []model.Region {
+	return GetRegionsByFilter(" WHERE r.owner = ?", []interface{}{owner})
+}
+
+func GetRegion(id int) (model.Region, error) {
+	regions := GetRegionsByFilter(" WHERE r.id = ?", []interface{}{id})
+	if len(regions) != 1 {
+		return model.Region{}, fmt.Errorf("requested region was not found")
+	}
+	return regions[0], nil
+}
+
+func DeleteRegion(id int) error {
+	// Create and run SQL query
+	_, err := db.Exec("DELETE FROM regions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to remove region from database: %v", err)
+	}
+	return nil
+}
+
+// GetTrackerRegions returns the regions currently held by trackerID
+func GetTrackerRegions(trackerID string) []model.TrackerRegion {
+	var regions []model.TrackerRegion
+	// Create and run SQL query
+	rows, err := db.Query("SELECT "+regionColumns+",tr.trackerId,tr.pushedAt FROM tracker_regions AS tr INNER JOIN regions AS r ON r.id = tr.regionId WHERE tr.trackerId = ? ORDER BY r.id ASC", trackerID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tr model.TrackerRegion
+		tr.Region, err = scanRegion(rows, &tr.TrackerId, &tr.PushedAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regions = append(regions, tr)
+	}
+	return regions
+}
+
+// CountRegionHolders returns the number of trackers holding region id
+func CountRegionHolders(id int) (int, error) {
+	var count int
+	// Create and run SQL query
+	row := db.QueryRow("SELECT COUNT(*) FROM tracker_regions WHERE regionId = ?", id)
+	if err := row.Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count trackers holding region: %v", err)
+	}
+	return count, nil
+}
+
+func AddTrackerRegion(trackerID string, regionID int, pushedAt int64) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT OR REPLACE INTO tracker_regions (trackerId,regionId,pushedAt) VALUES (?,?,?)", trackerID, regionID, pushedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add region to %v: %v", trackerID, err)
+	}
+	return nil
+}
+
+func RemoveTrackerRegion(trackerID string, regionID int) error {
+	// Create and run SQL query
+	_, err := db.Exec("DELETE FROM tracker_regions WHERE trackerId = ? AND regionId = ?", trackerID, regionID)
+	if err != nil {
+		return fmt.Errorf("failed to remove region from %v: %v", trackerID, err)
+	}
+	return nil
+}
+
 // Tracker Models
 func GetModelsByFilter(whereClause string, args []interface{}) []model.Model {
 	var m []model.Model
@@ -355,6 +1145,17 @@ func SaveAuthCode(t model.AuthCode) error {
 	return nil
 }
 
+// JT808 Registrations
+func SaveRegistration(r model.Registration) error {
+	// Create and run SQL query
+	_, err := db.Exec("INSERT OR REPLACE INTO jt808_registrations (trackerId,timestamp,provinceId,cityId,manufacturerId,terminalModel,terminalId,plateColour,plateNumber) VALUES (?,?,?,?,?,?,?,?,?)",
+		r.TrackerId, r.Timestamp, r.ProvinceId, r.CityId, r.ManufacturerId, r.TerminalModel, r.TerminalId, r.PlateColour, r.PlateNumber)
+	if err != nil {
+		return fmt.Errorf("failed to insert registration into database: %v", err)
+	}
+	return nil
+}
+
 func RemoveAuthCode(trackerId string) error {
 	// Create and run SQL query
 	_, err := db.Exec("DELETE FROM jt808_authcodes WHERE trackerId = ?", trackerId)
@@ -393,6 +1194,20 @@ func SetCommandSubstituation(submapin map[string]string) {
 	submap = submapin
 }
 
+// Set directory where uploaded media files are stored
+func SetMediaDir(dir string) {
+	if dir != "" {
+		mediaDir = dir
+	}
+}
+
+// Set directory where firmware files are stored
+func SetFirmwareDir(dir string) {
+	if dir != "" {
+		firmwareDir = dir
+	}
+}
+
 // Substitude text in command based on submap
 // This is used to fill in variables in provisioning SMS messages
 func SubstituteCommand(command string) string {
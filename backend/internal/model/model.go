@@ -13,18 +13,33 @@ type TrackerManager struct {
 }
 
 type TrackerHandler struct {
-	Id           string
-	CommandQueue chan TrackerCommand
-	EventHandler chan Locationdata
-	Conn         net.Conn
-	SerialNumber uint16
-	DoneFlag     chan bool
+	Id              string
+	Protocol        int
+	ProtocolVersion uint8
+	CommandQueue    chan TrackerCommand
+	EventHandler    chan Locationdata
+	Conn            net.Conn
+	SerialNumber    uint16
+	DoneFlag        chan bool
 }
 
+// Command passed from the API to a tracker handler
+// Text commands use Payload and Response. Protocol specific messages set MsgType and Body instead,
+// and the handler replies on Result with the packet the tracker responded with
 type TrackerCommand struct {
 	TrackerId string
 	Payload   string
 	Response  chan string
+	MsgType   uint16
+	Body      []byte
+	Result    chan CommandResult
+	// Number of acknowledged sub-packages, if Body is sent as sub-packages
+	Progress chan int
+}
+
+type CommandResult struct {
+	Packet Packet
+	Err    error
 }
 
 // Structs for database tables
@@ -36,11 +51,15 @@ type Tracker struct {
 	Model         string
 	Enabled       bool
 	LastConnected int64
+	IMSI          string
+	ICCID         string
 }
 
 type TrackerWithLocation struct {
 	Tracker
-	Ld *Locationdata
+	Ld           *Locationdata
+	Status       *TerminalStatus
+	Registration *Registration
 }
 
 type User struct {
@@ -51,14 +70,212 @@ type User struct {
 	Enabled bool
 }
 
+// Timestamp is the GPS fix time reported by the device, and ReceivedAt is when the server received it
+// Fields after Heading are only reported by some protocols, and pointer fields are nil when not reported
 type Locationdata struct {
-	EntryId   uint64
+	EntryId        uint64
+	TrackerId      string
+	Timestamp      int64
+	ReceivedAt     int64
+	Lat            int32
+	Lon            int32
+	Speed          uint16
+	Heading        uint16
+	Historic       bool // Buffered position re-uploaded after being offline
+	Altitude       uint16
+	AlarmFlags     uint32
+	Status         uint32
+	Mileage        *uint32 // 0.1 km
+	Fuel           *uint16 // 0.1 L
+	RecorderSpeed  *uint16 // 0.1 km/h
+	SignalStrength *uint8
+	Satellites     *uint8
+	AdditionalInfo []byte // Raw additional information items
+	DriverId       *int   // Driver logged in when the position was reported
+}
+
+// Terminal status reported in heartbeats
+type TerminalStatus struct {
+	EntryId         uint64
+	TrackerId       string
+	Timestamp       int64
+	OilCut          bool
+	GPSTracking     bool
+	Alarm           uint8
+	Charging        bool
+	ACC             bool
+	Defense         bool
+	VoltageLevel    uint8
+	ExternalVoltage uint16
+	GSMSignal       uint8
+}
+
+// SerialNumber is the serial number of the JT808 message which reported the alarm, and is nil for other protocols
+// AcknowledgedBy and AcknowledgedAt are set when a user has acknowledged the alarm
+type Alarm struct {
+	EntryId        uint64
+	TrackerId      string
+	Timestamp      int64
+	Type           uint16
+	Name           string
+	Lat            int32
+	Lon            int32
+	SerialNumber   *uint16
+	AcknowledgedBy *int
+	AcknowledgedAt *int64
+}
+
+// Period in which a tracker reports its position at Interval seconds
+// Sessions are active until ExpiresAt, which is set to the stop time if stopped early
+type TrackingSession struct {
+	EntryId   int
+	TrackerId string
+	UserId    int
+	StartedAt int64
+	Interval  uint16
+	ExpiresAt int64
+}
+
+// Details sent by a JT808 terminal when registering
+type Registration struct {
+	TrackerId      string
+	Timestamp      int64
+	ProvinceId     uint16
+	CityId         uint16
+	ManufacturerId string
+	TerminalModel  string
+	TerminalId     string
+	PlateColour    uint8
+	PlateNumber    string
+}
+
+// Multimedia file uploaded by a tracker, with the position it was captured at
+// Path is the location of the file on disk
+type Media struct {
+	EntryId    int
+	TrackerId  string
+	MediaId    uint32
+	Type       uint8
+	Format     uint8
+	Event      uint8
+	Channel    uint8
+	Timestamp  int64
+	ReceivedAt int64
+	Lat        int32
+	Lon        int32
+	AlarmFlags uint32
+	Path       string
+	Size       int
+}
+
+// Driver identified by the qualification certificate on their IC card
+// LastSeen is when a tracker last reported the card being inserted
+type Driver struct {
+	Id                int
+	Name              string
+	Certificate       string
+	Agency            string
+	CertificateExpiry string
+	IdNumber          string
+	LastSeen          int64
+}
+
+// Period in which a driver was logged in to a tracker. EndedAt is nil while the driver is logged in
+type Trip struct {
+	Id        int
+	DriverId  int
+	TrackerId string
+	StartedAt int64
+	EndedAt   *int64
+}
+
+// Data passed through a JT808 terminal from a peripheral, such as a serial port sensor
+// Timestamp is when the server received it
+type PassthroughData struct {
+	EntryId   int
 	TrackerId string
 	Timestamp int64
-	Lat       uint32
-	Lon       uint32
-	Speed     uint16
-	Heading   uint16
+	Type      uint8
+	Data      []byte
+}
+
+// Firmware upgrade types
+const (
+	FirmwareTypeTerminal     uint8 = 0
+	FirmwareTypeICCardReader uint8 = 12
+	FirmwareTypeGNSS         uint8 = 52
+)
+
+// Firmware file for a tracker model. Path is the location of the file on disk
+type Firmware struct {
+	Id             int
+	Model          string
+	Version        string
+	Type           uint8
+	ManufacturerId string
+	Path           string
+	Size           int
+	UploadedAt     int64
+}
+
+// Firmware upgrade statuses
+const (
+	FirmwareUpgradeSending   = "sending"
+	FirmwareUpgradeSent      = "sent"
+	FirmwareUpgradeSucceeded = "succeeded"
+	FirmwareUpgradeFailed    = "failed"
+	FirmwareUpgradeCancelled = "cancelled"
+)
+
+// Upgrade of a tracker to a firmware. The status is sending while packages are sent,
+// sent while waiting for the tracker to report the result, and then succeeded, failed or cancelled
+type FirmwareUpgrade struct {
+	Id            int
+	TrackerId     string
+	FirmwareId    int
+	StartedAt     int64
+	UpdatedAt     int64
+	Status        string
+	SentPackages  int
+	TotalPackages int
+}
+
+// Region types
+const (
+	RegionTypeCircle    = "circle"
+	RegionTypeRectangle = "rectangle"
+	RegionTypePolygon   = "polygon"
+	RegionTypeRoute     = "route"
+)
+
+// Geofence region defined on the server, which can be pushed to JT808 trackers
+// Points are the center of a circle, top-left and bottom-right corner of a rectangle, vertices of a polygon or inflection points of a route
+// Radius and Width are in meters, MaxSpeed in km/h and OverspeedDuration in seconds
+type Region struct {
+	Id                int
+	Owner             int
+	Name              string
+	Type              string
+	Points            []Point
+	Radius            uint32
+	Width             uint8
+	MaxSpeed          *uint16
+	OverspeedDuration uint8
+	AlarmOnEnter      bool
+	AlarmOnExit       bool
+}
+
+// Coordinates use the same precision as Locationdata
+type Point struct {
+	Lat int32
+	Lon int32
+}
+
+// Region currently held by a tracker
+type TrackerRegion struct {
+	Region
+	TrackerId string
+	PushedAt  int64
 }
 
 type AuthCode struct {
@@ -98,4 +315,7 @@ type Packet struct {
 	Payload       []byte
 	SerialNumber  uint16
 	ErrorCheck    uint16
+	Version       uint8
+	PackageCount  uint16 // Total packages of a sub-packaged message, 0 if not sub-packaged
+	PackageIndex  uint16 // Index of package starting at 1
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"time"
 
 	"banjo.dev/trackerr/internal/model"
@@ -29,32 +30,33 @@ const (
 	MsgTypeCmdSend      uint8         = 0x80
 	MsgTypeIMSI         uint8         = 0x90
 	MsgTypeICCID        uint8         = 0x94
+	InfoTypeICCID       uint8         = 0x0A
 	HeartbeatInterval   time.Duration = 5 * time.Minute
 )
 
 var alarmTypes = map[uint8]string{
-	0x00: ":Normal",
-	0x01: ":SOS",
-	0x02: ":Power Failure",
-	0x03: ":Vibration",
-	0x04: ":Entering Fence",
-	0x05: ":Exiting Fence",
-	0x06: ":Speeding",
-	0x07: ":High Temperature",
-	0x08: ":Low Temperature",
-	0x09: ":Displacement",
-	0x13: ":Anti-Tamper",
-	0x26: ":Rapid Acceleration",
-	0x27: ":Rapid Deacceleration",
-	0x28: ":Sharp Turn",
-	0x29: ":Collision",
-	0x0E: ":Low Battery",
-	0xFA: ":Door closed",
-	0xFB: ":Door opened",
-	0xFC: ":AC off",
-	0xFD: ":AC on",
-	0xFE: ":ACC ignition",
-	0xFF: ":ACC flameout",
+	0x00: "Normal",
+	0x01: "SOS",
+	0x02: "Power Failure",
+	0x03: "Vibration",
+	0x04: "Entering Fence",
+	0x05: "Exiting Fence",
+	0x06: "Speeding",
+	0x07: "High Temperature",
+	0x08: "Low Temperature",
+	0x09: "Displacement",
+	0x13: "Anti-Tamper",
+	0x26: "Rapid Acceleration",
+	0x27: "Rapid Deacceleration",
+	0x28: "Sharp Turn",
+	0x29: "Collision",
+	0x0E: "Low Battery",
+	0xFA: "Door closed",
+	0xFB: "Door opened",
+	0xFC: "AC off",
+	0xFD: "AC on",
+	0xFE: "ACC ignition",
+	0xFF: "ACC flameout",
 }
 
 // Perform GT06 authentication after receiving first packet p
@@ -140,27 +142,98 @@ func ParseCmdRes(payload []byte) (string, uint32) {
 }
 
 // Parse alarm message
-func ParseAlarmMsg(payload []byte) (model.Locationdata, string) {
+// Payload is date(6), GPS(12), LBS(9), terminal info(1), voltage level(1), GSM signal(1), alarm type(1) and language(1)
+func ParseAlarmMsg(payload []byte) (model.Locationdata, model.Alarm, error) {
+	if len(payload) < 32 {
+		return model.Locationdata{}, model.Alarm{}, fmt.Errorf("alarm payload too short: %v bytes", len(payload))
+	}
 	// Parse location data section
-	ld := ParseLocationMsg(payload)
+	ld, err := ParseLocationMsg(payload)
+	if err != nil {
+		return ld, model.Alarm{}, err
+	}
+	alarm := model.Alarm{
+		Timestamp: ld.Timestamp,
+		Type:      uint16(payload[30]),
+		Name:      "Unknown",
+		Lat:       ld.Lat,
+		Lon:       ld.Lon,
+	}
 	// Lookup alarm name
-	if name, ok := alarmTypes[payload[31]]; ok {
-		return ld, name
+	if name, ok := alarmTypes[payload[30]]; ok {
+		alarm.Name = name
 	}
-	return ld, "Unknown"
+	return ld, alarm, nil
 }
 
-func ParseLocationMsg(payload []byte) model.Locationdata {
+// Parse IMSI message. IMSI is sent as 8 byte BCD with a leading 0
+func ParseIMSIMsg(payload []byte) (string, error) {
+	if len(payload) < 8 {
+		return "", fmt.Errorf("imsi payload too short: %v bytes", len(payload))
+	}
+	return hex.EncodeToString(payload[0:8])[1:], nil
+}
+
+// Parse information transmission message of ICCID type
+// Payload is info type(1), IMEI(8), IMSI(8), ICCID(10), all in BCD
+func ParseICCIDMsg(payload []byte) (string, string, error) {
+	if len(payload) < 27 || payload[0] != InfoTypeICCID {
+		return "", "", fmt.Errorf("not an iccid information message")
+	}
+	imsi := hex.EncodeToString(payload[9:17])[1:]
+	// ICCIDs with 19 digits are padded with F
+	iccid := strings.TrimRight(hex.EncodeToString(payload[17:27]), "f")
+	return imsi, iccid, nil
+}
+
+// Parse heartbeat message
+// Payload is terminal info(1), voltage level(1), gsm signal(1), alarm/language(2).
+// Some devices replace the voltage level with a 2 byte external voltage in 0.01V
+func ParseHeartbeatMsg(payload []byte) (model.TerminalStatus, error) {
+	var ts model.TerminalStatus
+	if len(payload) < 3 {
+		return ts, fmt.Errorf("heartbeat payload too short: %v bytes", len(payload))
+	}
+	info := payload[0]
+	ts.OilCut = info&0x80 != 0
+	ts.GPSTracking = info&0x40 != 0
+	ts.Alarm = (info >> 3) & 0x07
+	ts.Charging = info&0x04 != 0
+	ts.ACC = info&0x02 != 0
+	ts.Defense = info&0x01 != 0
+	if len(payload) == 6 {
+		ts.ExternalVoltage = binary.BigEndian.Uint16(payload[1:3])
+		ts.GSMSignal = payload[3]
+		return ts, nil
+	}
+	ts.VoltageLevel = payload[1]
+	ts.GSMSignal = payload[2]
+	return ts, nil
+}
+
+// Parse location message
+// Payload starts with date(6) and GPS(12)
+func ParseLocationMsg(payload []byte) (model.Locationdata, error) {
 	var ld model.Locationdata
+	if len(payload) < 18 {
+		return ld, fmt.Errorf("location payload too short: %v bytes", len(payload))
+	}
 	ld.Timestamp = parseTime(payload[0:6])
 	gpsSection := payload[6:18]
-	ld.Lat = binary.BigEndian.Uint32(gpsSection[1:5])
-	ld.Lon = binary.BigEndian.Uint32(gpsSection[5:9])
+	ld.Lat = int32(binary.BigEndian.Uint32(gpsSection[1:5]))
+	ld.Lon = int32(binary.BigEndian.Uint32(gpsSection[5:9]))
 	ld.Speed = uint16(gpsSection[9])
+	// Bit 2 of course/status is set for northern latitude and bit 3 is set for western longitude
+	if gpsSection[10]&0x04 == 0 {
+		ld.Lat = -ld.Lat
+	}
+	if gpsSection[10]&0x08 != 0 {
+		ld.Lon = -ld.Lon
+	}
 	front := gpsSection[10] & 3
 	ld.Heading = binary.BigEndian.Uint16([]byte{front, gpsSection[11]})
 	utils.StdLatLon(&ld, coordinatePrecision)
-	return ld
+	return ld, nil
 }
 
 // Convert time from [yy,mm,dd,hh,mm,ss] to unix time
@@ -0,0 +1,135 @@
+package gt06
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// GT06 protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeGT06
+}
+
+func (Protocol) Name() string {
+	return "GT06"
+}
+
+func (Protocol) Detect(start byte) bool {
+	return start == StartByte || start == StartByteExtended
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	// Verify that also the second byte is valid
+	start2, err := utils.ReadBytes(conn, 1)
+	if err != nil {
+		return model.Packet{}, err
+	}
+	if start != start2[0] {
+		return model.Packet{}, fmt.Errorf("invalid second start byte: %#02x %#02x", start, start2[0])
+	}
+	return ParseMsg(conn, start == StartByteExtended)
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	id, err := PerformAuth(conn, p)
+	return id, 0, err
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	return &Session{t: t}
+}
+
+// Connection to a GT06 tracker
+type Session struct {
+	t *model.TrackerHandler
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	t := s.t
+	// The serial number is used as command id, which is included in the response
+	id := uint32(t.SerialNumber)
+	SendCmd(t.Conn, command, t.SerialNumber, id)
+	t.SerialNumber++
+	return id, nil
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	return fmt.Errorf("message %#04x is not supported by GT06", cmd.MsgType)
+}
+
+func (s *Session) Tick(now time.Time) {}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	switch uint8(p.PacketType) {
+	// Location update
+	case MsgTypeLocation, MsgTypeLocation4g:
+		ld, err := ParseLocationMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse location: %v", err)
+		}
+		return []protocols.Event{{Location: &ld}}, nil
+	// Heartbeat
+	case MsgTypeHeartbeat:
+		log.Printf("%v: Received heartbeat\n", t.Id)
+		SendMsg(t.Conn, false, MsgTypeHeartbeat, []byte{}, p.SerialNumber)
+		event := protocols.Event{Heartbeat: true}
+		// Store terminal info, voltage level and gsm signal strength
+		ts, err := ParseHeartbeatMsg(p.Payload)
+		if err != nil {
+			return []protocols.Event{event}, fmt.Errorf("failed to parse heartbeat: %v", err)
+		}
+		ts.Timestamp = time.Now().Unix()
+		event.Status = &ts
+		return []protocols.Event{event}, nil
+	// Server cmd response
+	case MsgTypeCmdResponse:
+		r, id := ParseCmdRes(p.Payload)
+		return []protocols.Event{{CmdResponse: &protocols.CmdResponse{Id: id, HasId: true, Text: r}}}, nil
+	// Alarm
+	case MsgTypeAlarm:
+		ld, alarm, err := ParseAlarmMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse alarm: %v", err)
+		}
+		// Alarm type 0x00 is normal, which is only a position
+		if alarm.Type == 0x00 {
+			return []protocols.Event{{Location: &ld}}, nil
+		}
+		return []protocols.Event{{Alarm: &alarm}, {Location: &ld}}, nil
+	// IMSI
+	case MsgTypeIMSI:
+		imsi, err := ParseIMSIMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IMSI: %v", err)
+		}
+		return []protocols.Event{{IMSI: imsi}}, nil
+	// ICCID
+	case MsgTypeICCID:
+		imsi, iccid, err := ParseICCIDMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ICCID: %v", err)
+		}
+		return []protocols.Event{{IMSI: imsi, ICCID: iccid}}, nil
+	// Unknown
+	default:
+		log.Printf("%v: Unknown protocol number: %x\nPayload:%v", t.Id, p.PacketType, p.Payload)
+	}
+	return nil, nil
+}
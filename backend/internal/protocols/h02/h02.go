@@ -0,0 +1,288 @@
+package h02
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Constants specific to H02
+const (
+	StartByte           byte    = '*'
+	StartByteBinary     byte    = '$'
+	EndByte             byte    = '#'
+	coordinatePrecision float64 = 1000000
+	knotsToKmh          float64 = 1.852
+	MsgTypePosition     string  = "V1"
+	MsgTypeCmdRes       string  = "V4"
+	MsgTypeLBS          string  = "NBR"
+	MsgTypeLink         string  = "LINK"
+	MsgTypeHeartbeat    string  = "HTBT"
+	// Cut (1) or restore (0) the oil and power supply
+	CmdCutOil string = "S20"
+	// Set reporting interval in seconds
+	CmdInterval string = "D1"
+	// Length of binary messages, excluding the start byte
+	binaryLength int = 31
+	// Longest text message accepted, to limit the buffer used while waiting for the end byte
+	maxTextLength int = 1024
+	// Trackers send a position or link message at least every few minutes, even when stopped
+	HeartbeatInterval time.Duration = 10 * time.Minute
+)
+
+// Names of the alarm bits of the status word, keyed by bit number
+// Status bits use negative logic, so an alarm is active when its bit is cleared
+var alarmTypes = map[uint16]string{
+	0:  "Vibration",
+	1:  "SOS",
+	2:  "Speeding",
+	19: "Power Failure",
+}
+
+// Perform H02 authentication after receiving first message p
+// H02 has no login message, so trackers are identified by the id sent in every message
+func PerformAuth(p model.Packet) (string, error) {
+	if p.DeviceID == "" {
+		return "", fmt.Errorf("message does not contain a device id")
+	}
+	return p.DeviceID, nil
+}
+
+// Parse H02 message, after the start byte has been read
+// Text messages start with * and end with #, and their payload is the text in between.
+// Binary messages start with $ and have a fixed length, and their payload is the bytes following the start byte.
+// The packet type is the start byte
+func ParseMsg(conn io.Reader, start byte) (model.Packet, error) {
+	p := model.Packet{PacketType: uint16(start)}
+	if start == StartByteBinary {
+		payload, err := utils.ReadBytes(conn, binaryLength)
+		if err != nil {
+			return p, fmt.Errorf("failed to read binary message: %v", err)
+		}
+		p.Payload = payload
+		p.PayloadLength = uint16(len(payload))
+		p.DeviceID = hex.EncodeToString(payload[0:5])
+		return p, nil
+	}
+	// Read one byte at a time, to not consume the following message
+	var text []byte
+	for {
+		b, err := utils.ReadBytes(conn, 1)
+		if err != nil {
+			return p, fmt.Errorf("failed to read text message: %v", err)
+		}
+		if b[0] == EndByte {
+			break
+		}
+		if len(text) >= maxTextLength {
+			return p, fmt.Errorf("text message exceeds %v bytes", maxTextLength)
+		}
+		text = append(text, b[0])
+	}
+	p.Payload = text
+	p.PayloadLength = uint16(len(text))
+	fields := strings.Split(string(text), ",")
+	if len(fields) < 3 || fields[0] != "HQ" {
+		return p, fmt.Errorf("invalid text message: %q", text)
+	}
+	p.DeviceID = fields[1]
+	return p, nil
+}
+
+// Split text message payload into its type and the fields following it
+func ParseTextMsg(payload []byte) (string, []string) {
+	fields := strings.Split(string(payload), ",")
+	return fields[2], fields[3:]
+}
+
+// Parse position message
+// Fields are time(HHMMSS), validity(A/V), lat(DDMM.MMMM), N/S, lon(DDDMM.MMMM), E/W, speed in knots, course, date(DDMMYY), status(8 hex digits),
+// which may be followed by cell information
+// Returns false if the position is not a valid GPS fix, in which case it is the last known position
+func ParsePositionMsg(fields []string) (model.Locationdata, bool, error) {
+	var ld model.Locationdata
+	if len(fields) < 10 {
+		return ld, false, fmt.Errorf("position message has %v fields", len(fields))
+	}
+	lat, err := parseCoordinate(fields[2], fields[3] == "S")
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid latitude: %v", err)
+	}
+	lon, err := parseCoordinate(fields[4], fields[5] == "W")
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid longitude: %v", err)
+	}
+	speed, _ := strconv.ParseFloat(fields[6], 64)
+	course, _ := strconv.ParseFloat(fields[7], 64)
+	status, err := strconv.ParseUint(fields[9], 16, 32)
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid status: %v", err)
+	}
+	ld.Timestamp = parseTime(fields[0], fields[8])
+	ld.Lat = lat
+	ld.Lon = lon
+	ld.Speed = uint16(speed * knotsToKmh)
+	ld.Heading = uint16(course)
+	setStatus(&ld, uint32(status))
+	utils.StdLatLon(&ld, coordinatePrecision)
+	return ld, fields[1] == "A", nil
+}
+
+// Parse binary position message
+// Payload is id(5), time(3), date(3), lat(4), battery(1), lon and flags(5), speed and course(3), status(4)
+// followed by 3 unused bytes. All values except the status are BCD.
+// The lower 4 bits of the longitude are flags, where bit 1 is set for a valid GPS fix, bit 2 is set for northern latitude
+// and bit 3 is set for eastern longitude
+// Returns false if the position is not a valid GPS fix, in which case it is the last known position
+func ParseBinaryMsg(payload []byte) (model.Locationdata, bool, error) {
+	var ld model.Locationdata
+	if len(payload) < 28 {
+		return ld, false, fmt.Errorf("binary message too short: %v bytes", len(payload))
+	}
+	digits := hex.EncodeToString(payload)
+	ld.Timestamp = parseTime(digits[10:16], digits[16:22])
+	flags := payload[20] & 0x0F
+	lat, err := parseCoordinate(digits[22:26]+"."+digits[26:30], flags&0x04 == 0)
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid latitude: %v", err)
+	}
+	lon, err := parseCoordinate(digits[32:37]+"."+digits[37:41], flags&0x08 == 0)
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid longitude: %v", err)
+	}
+	speed, _ := strconv.Atoi(digits[42:45])
+	course, _ := strconv.Atoi(digits[45:48])
+	ld.Lat = lat
+	ld.Lon = lon
+	ld.Speed = uint16(float64(speed) * knotsToKmh)
+	ld.Heading = uint16(course)
+	status, _ := strconv.ParseUint(digits[48:56], 16, 32)
+	setStatus(&ld, uint32(status))
+	utils.StdLatLon(&ld, coordinatePrecision)
+	return ld, flags&0x02 != 0, nil
+}
+
+// Parse link message, which is sent as heartbeat
+// Fields are time(HHMMSS), gsm signal, satellites, battery level, steps, rolls, date(DDMMYY), status
+func ParseLinkMsg(fields []string) (model.TerminalStatus, error) {
+	var ts model.TerminalStatus
+	if len(fields) < 3 {
+		return ts, fmt.Errorf("link message has %v fields", len(fields))
+	}
+	signal, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ts, fmt.Errorf("invalid gsm signal: %v", err)
+	}
+	satellites, _ := strconv.Atoi(fields[2])
+	ts.GSMSignal = uint8(signal)
+	ts.GPSTracking = satellites > 0
+	return ts, nil
+}
+
+// Parse LBS message, which is sent instead of a position when there is no GPS fix
+// Fields are time(HHMMSS), mcc, mnc, timing advance, count, count cells of lac, cell id, rssi, date(DDMMYY) and status
+// Returns the time and status word, since cell positions are not resolved
+func ParseLBSMsg(fields []string) (int64, uint32, error) {
+	if len(fields) < 7 {
+		return 0, 0, fmt.Errorf("lbs message has %v fields", len(fields))
+	}
+	status, err := strconv.ParseUint(fields[len(fields)-1], 16, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status: %v", err)
+	}
+	return parseTime(fields[0], fields[len(fields)-2]), uint32(status), nil
+}
+
+// Store status word in ld, and set the alarm flags of the alarms active in it
+func setStatus(ld *model.Locationdata, status uint32) {
+	ld.Status = status
+	ld.AlarmFlags = ActiveAlarms(status)
+}
+
+// Get flags of the alarms active in status word
+func ActiveAlarms(status uint32) uint32 {
+	var flags uint32
+	for bit := range alarmTypes {
+		if status&(1<<bit) == 0 {
+			flags |= 1 << bit
+		}
+	}
+	return flags
+}
+
+// Get alarm events of the alarm flags set in ld, which were not set in previous flags
+// Alarm types are the bit number of the status word
+func ParseAlarms(ld model.Locationdata, previous uint32) []model.Alarm {
+	var alarms []model.Alarm
+	raised := ld.AlarmFlags &^ previous
+	for bit := uint16(0); bit < 32; bit++ {
+		name, ok := alarmTypes[bit]
+		if !ok || raised&(1<<bit) == 0 {
+			continue
+		}
+		alarms = append(alarms, model.Alarm{
+			Timestamp: ld.Timestamp,
+			Type:      bit,
+			Name:      name,
+			Lat:       ld.Lat,
+			Lon:       ld.Lon,
+		})
+	}
+	return alarms
+}
+
+// Parse coordinate of format (D)DDMM.MMMM, which is negated if negative is set
+func parseCoordinate(s string, negative bool) (int32, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	degrees := float64(int(v / 100))
+	minutes := v - degrees*100
+	c := int32((degrees + minutes/60) * coordinatePrecision)
+	if negative {
+		c = -c
+	}
+	return c, nil
+}
+
+// Convert time of format HHMMSS and date of format DDMMYY to unix time
+func parseTime(hms string, dmy string) int64 {
+	t, err := time.Parse("150405020106", hms+dmy)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Encode text command cmd with parameters params, sent to tracker with id
+func EncodeCmd(id string, cmd string, params []string, now time.Time) string {
+	fields := append([]string{"*HQ", id, cmd, now.UTC().Format("150405")}, params...)
+	return strings.Join(fields, ",") + string(EndByte)
+}
+
+// Encode heartbeat response to message of msgType
+func EncodeHeartbeatRes(id string, msgType string, now time.Time) string {
+	if msgType == MsgTypeHeartbeat {
+		return fmt.Sprintf("*HQ,%v,%v#", id, msgType)
+	}
+	return fmt.Sprintf("*HQ,%v,%v,%v,%v#", id, MsgTypeCmdRes, msgType, now.UTC().Format("20060102150405"))
+}
+
+// Send text message
+func SendMsg(conn net.Conn, msg string) {
+	conn.Write([]byte(msg))
+}
+
+// Send command, given as the command name followed by its comma separated parameters, such as "S20,1,1"
+func SendCmd(conn net.Conn, id string, command string) {
+	fields := strings.Split(strings.TrimSpace(command), ",")
+	SendMsg(conn, EncodeCmd(id, fields[0], fields[1:], time.Now()))
+}
@@ -0,0 +1,154 @@
+package h02
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Read frame, after the start byte as read by the protocol registry
+func readFrame(t *testing.T, frame []byte) model.Packet {
+	t.Helper()
+	p, err := ParseMsg(bytes.NewReader(frame[1:]), frame[0])
+	if err != nil {
+		t.Fatalf("ParseMsg: %v", err)
+	}
+	return p
+}
+
+// Check that coordinate c is deg degrees, within the precision of the standard coordinates
+func checkCoordinate(t *testing.T, name string, c int32, deg float64) {
+	t.Helper()
+	got := float64(utils.FromStdCoordinate(c, coordinatePrecision)) / coordinatePrecision
+	if diff := got - deg; diff > 0.00001 || diff < -0.00001 {
+		t.Errorf("%v = %v, want %v", name, got, deg)
+	}
+}
+
+func unix(s string) int64 {
+	t, _ := time.Parse(time.DateTime, s)
+	return t.Unix()
+}
+
+func TestParsePositionMsg(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     string
+		valid     bool
+		lat, lon  float64
+		speed     uint16
+		timestamp int64
+		alarms    uint32
+	}{
+		{
+			name:      "valid fix",
+			frame:     "*HQ,865205030330012,V1,145452,A,2240.55181,N,11358.32389,E,10.00,90.00,100118,FFFFFBFF#",
+			valid:     true,
+			lat:       22.675863,
+			lon:       113.972065,
+			speed:     18,
+			timestamp: unix("2018-01-10 14:54:52"),
+		},
+		{
+			name:      "invalid fix with sos",
+			frame:     "*HQ,865205030330012,V1,145452,V,2240.55181,S,11358.32389,W,0.00,0.00,100118,FFFFFBFD#",
+			valid:     false,
+			lat:       -22.675863,
+			lon:       -113.972065,
+			timestamp: unix("2018-01-10 14:54:52"),
+			alarms:    1 << 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := readFrame(t, []byte(tt.frame))
+			if p.DeviceID != "865205030330012" {
+				t.Errorf("device id = %v", p.DeviceID)
+			}
+			msgType, fields := ParseTextMsg(p.Payload)
+			if msgType != MsgTypePosition {
+				t.Fatalf("type = %v, want %v", msgType, MsgTypePosition)
+			}
+			ld, valid, err := ParsePositionMsg(fields)
+			if err != nil {
+				t.Fatalf("ParsePositionMsg: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("valid = %v, want %v", valid, tt.valid)
+			}
+			checkCoordinate(t, "lat", ld.Lat, tt.lat)
+			checkCoordinate(t, "lon", ld.Lon, tt.lon)
+			if ld.Speed != tt.speed || ld.Timestamp != tt.timestamp || ld.AlarmFlags != tt.alarms {
+				t.Errorf("got speed %v time %v alarms %#x", ld.Speed, ld.Timestamp, ld.AlarmFlags)
+			}
+		})
+	}
+}
+
+func TestParseLBSMsg(t *testing.T) {
+	p := readFrame(t, []byte("*HQ,865205030330012,NBR,145452,460,0,0,1,9520,3671,24,100118,FFFFFBFD#"))
+	msgType, fields := ParseTextMsg(p.Payload)
+	if msgType != MsgTypeLBS {
+		t.Fatalf("type = %v, want %v", msgType, MsgTypeLBS)
+	}
+	timestamp, status, err := ParseLBSMsg(fields)
+	if err != nil {
+		t.Fatalf("ParseLBSMsg: %v", err)
+	}
+	if timestamp != unix("2018-01-10 14:54:52") || status != 0xFFFFFBFD {
+		t.Errorf("got time %v status %#x", timestamp, status)
+	}
+	if alarms := ParseAlarms(model.Locationdata{AlarmFlags: ActiveAlarms(status)}, 0); len(alarms) != 1 || alarms[0].Name != "SOS" {
+		t.Errorf("alarms = %+v, want SOS", alarms)
+	}
+}
+
+func TestParseBinaryMsg(t *testing.T) {
+	// Id, time, date, lat, battery, lon with flags, speed 10 knots and course, status and 3 unused bytes
+	const body = "4210203971" + "145452" + "100118" + "22405518" + "06" + "113583238%s" + "010090" + "FFFFFBFF" + "000000"
+	tests := []struct {
+		name     string
+		flags    string
+		valid    bool
+		lat, lon float64
+	}{
+		{"valid north east", "E", true, 22.675863, 113.972063},
+		{"invalid south west", "0", false, -22.675863, -113.972063},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := hex.DecodeString(fmt.Sprintf(body, tt.flags))
+			if err != nil {
+				t.Fatalf("invalid hex: %v", err)
+			}
+			p := readFrame(t, append([]byte{StartByteBinary}, b...))
+			if p.DeviceID != "4210203971" {
+				t.Errorf("device id = %v", p.DeviceID)
+			}
+			ld, valid, err := ParseBinaryMsg(p.Payload)
+			if err != nil {
+				t.Fatalf("ParseBinaryMsg: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("valid = %v, want %v", valid, tt.valid)
+			}
+			checkCoordinate(t, "lat", ld.Lat, tt.lat)
+			checkCoordinate(t, "lon", ld.Lon, tt.lon)
+			if ld.Timestamp != unix("2018-01-10 14:54:52") || ld.Speed != 18 || ld.Heading != 90 {
+				t.Errorf("got time %v speed %v heading %v", ld.Timestamp, ld.Speed, ld.Heading)
+			}
+		})
+	}
+}
+
+func TestEncodeHeartbeatRes(t *testing.T) {
+	now := time.Date(2018, 1, 10, 14, 54, 52, 0, time.UTC)
+	if got, want := EncodeHeartbeatRes("865205030330012", MsgTypeLink, now), "*HQ,865205030330012,V4,LINK,20180110145452#"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package h02
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/database"
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// H02 protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeH02
+}
+
+func (Protocol) Name() string {
+	return "H02"
+}
+
+func (Protocol) Detect(start byte) bool {
+	return start == StartByte || start == StartByteBinary
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	return ParseMsg(conn, start)
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	id, err := PerformAuth(p)
+	return id, 0, err
+}
+
+// Every H02 message is a report, so the first one is decoded as well
+func (Protocol) DecodeFirst(p model.Packet) bool {
+	return true
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	s := &Session{t: t}
+	if ld, err := database.GetLocation(t.Id); err == nil {
+		s.lastAlarmFlags = ld.AlarmFlags
+	}
+	return s
+}
+
+// Connection to a H02 tracker
+type Session struct {
+	t *model.TrackerHandler
+	// Alarm flags of the last report, so alarms are only stored when raised
+	lastAlarmFlags uint32
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	SendCmd(s.t.Conn, s.t.Id, command)
+	// Command responses do not refer to the command, so they are matched in order
+	return 0, nil
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	return fmt.Errorf("message %#04x is not supported by H02", cmd.MsgType)
+}
+
+func (s *Session) Tick(now time.Time) {}
+
+// Get events of position ld, including the alarms raised since the last report
+// Positions without a valid GPS fix are not stored, and their alarms are stored without position
+func (s *Session) positionEvents(ld model.Locationdata, valid bool) []protocols.Event {
+	if !valid {
+		ld.Lat, ld.Lon = 0, 0
+	}
+	events := []protocols.Event{{Heartbeat: true}}
+	for _, alarm := range ParseAlarms(ld, s.lastAlarmFlags) {
+		events = append(events, protocols.Event{Alarm: &alarm})
+	}
+	s.lastAlarmFlags = ld.AlarmFlags
+	if !valid {
+		return events
+	}
+	return append(events, protocols.Event{Location: &ld})
+}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	// Binary position
+	if byte(p.PacketType) == StartByteBinary {
+		ld, valid, err := ParseBinaryMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse binary position: %v", err)
+		}
+		return s.positionEvents(ld, valid), nil
+	}
+	msgType, fields := ParseTextMsg(p.Payload)
+	switch msgType {
+	// Position
+	case MsgTypePosition:
+		ld, valid, err := ParsePositionMsg(fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse position: %v", err)
+		}
+		return s.positionEvents(ld, valid), nil
+	// Cell information, when there is no GPS fix
+	case MsgTypeLBS:
+		timestamp, status, err := ParseLBSMsg(fields)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse lbs message: %v", err)
+		}
+		// Alarms are stored without position
+		ld := model.Locationdata{Timestamp: timestamp}
+		setStatus(&ld, status)
+		events := []protocols.Event{{Heartbeat: true}}
+		for _, alarm := range ParseAlarms(ld, s.lastAlarmFlags) {
+			events = append(events, protocols.Event{Alarm: &alarm})
+		}
+		s.lastAlarmFlags = ld.AlarmFlags
+		return events, nil
+	// Heartbeat
+	case MsgTypeLink, MsgTypeHeartbeat:
+		log.Printf("%v: Received heartbeat\n", t.Id)
+		SendMsg(t.Conn, EncodeHeartbeatRes(t.Id, msgType, time.Now()))
+		event := protocols.Event{Heartbeat: true}
+		if msgType == MsgTypeHeartbeat {
+			return []protocols.Event{event}, nil
+		}
+		ts, err := ParseLinkMsg(fields)
+		if err != nil {
+			return []protocols.Event{event}, fmt.Errorf("failed to parse link message: %v", err)
+		}
+		ts.Timestamp = time.Now().Unix()
+		event.Status = &ts
+		return []protocols.Event{event}, nil
+	// Command response
+	case MsgTypeCmdRes:
+		r := strings.Join(fields, ",")
+		return []protocols.Event{{CmdResponse: &protocols.CmdResponse{Text: r}}}, nil
+	// Unknown
+	default:
+		log.Printf("%v: Unknown message type: %v\nPayload:%s", t.Id, msgType, p.Payload)
+	}
+	return nil, nil
+}
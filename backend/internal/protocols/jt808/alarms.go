@@ -0,0 +1,90 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"banjo.dev/trackerr/internal/model"
+)
+
+// Names of the alarm flag bits reported in position messages, keyed by bit number
+var alarmTypes = map[uint16]string{
+	0:  "SOS",
+	1:  "Speeding",
+	2:  "Fatigue Driving",
+	3:  "Danger Warning",
+	4:  "GNSS Module Fault",
+	5:  "GNSS Antenna Disconnected",
+	6:  "GNSS Antenna Short Circuit",
+	7:  "Low Voltage",
+	8:  "Power Failure",
+	9:  "Display Fault",
+	10: "TTS Module Fault",
+	11: "Camera Fault",
+	12: "IC Card Module Fault",
+	13: "Speeding Warning",
+	14: "Fatigue Driving Warning",
+	18: "Driving Time Exceeded",
+	19: "Parking Timeout",
+	20: "Entering/Exiting Region",
+	21: "Entering/Exiting Route",
+	22: "Route Driving Time",
+	23: "Route Deviation",
+	24: "VSS Fault",
+	25: "Abnormal Fuel",
+	26: "Vehicle Stolen",
+	27: "Illegal Ignition",
+	28: "Illegal Displacement",
+	29: "Collision",
+	30: "Rollover",
+	31: "Illegal Door Opening",
+}
+
+// Alarm flag bits which are cleared by the platform acknowledging them, keyed by bit number
+var manualAckAlarms = map[uint16]bool{
+	0:  true,
+	3:  true,
+	20: true,
+	21: true,
+	22: true,
+	27: true,
+	28: true,
+}
+
+// Check if alarms of alarmType are acknowledged manually, since terminals only accept acknowledgement of those
+func IsManualAckAlarm(alarmType uint16) bool {
+	return manualAckAlarms[alarmType]
+}
+
+// Get alarm events of the alarm flags set in ld, which were not set in previous flags
+// Alarm types are the bit number of the flag
+func ParseAlarms(ld model.Locationdata, previous uint32) []model.Alarm {
+	var alarms []model.Alarm
+	raised := ld.AlarmFlags &^ previous
+	for bit := uint16(0); bit < 32; bit++ {
+		if raised&(1<<bit) == 0 {
+			continue
+		}
+		alarm := model.Alarm{
+			Timestamp: ld.Timestamp,
+			Type:      bit,
+			Name:      "Unknown",
+			Lat:       ld.Lat,
+			Lon:       ld.Lon,
+		}
+		if name, ok := alarmTypes[bit]; ok {
+			alarm.Name = name
+		}
+		alarms = append(alarms, alarm)
+	}
+	return alarms
+}
+
+// Encode manual alarm acknowledgement message body
+// Body is serial number of the alarm position message(2) and alarm flags to acknowledge(4)
+func EncodeAlarmAck(serialNumber uint16, alarmType uint16) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	binary.Write(buf, binary.BigEndian, serialNumber)
+	binary.Write(buf, binary.BigEndian, uint32(1)<<alarmType)
+	return buf.Bytes()
+}
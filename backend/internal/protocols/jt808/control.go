@@ -0,0 +1,69 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Terminal control command words
+const (
+	ControlConnectServer uint8 = 0x02
+	ControlReset         uint8 = 0x04
+	ControlFactoryReset  uint8 = 0x05
+	ControlCloseDataLink uint8 = 0x06
+	ControlCloseRadio    uint8 = 0x07
+)
+
+// Connection control value for switching to the specified server
+const connectionControlSpecified uint8 = 0
+
+// Server the terminal is instructed to connect to with ControlConnectServer
+type ServerConnection struct {
+	AuthCode  string // Authentication code of the specified server
+	APN       string
+	Username  string
+	Password  string
+	Address   string // IP address or domain
+	TCPPort   uint16
+	UDPPort   uint16
+	TimeLimit uint16 // Minutes to stay connected to the specified server
+}
+
+// Encode terminal control message body
+// Body is command word(1), followed by command parameters separated by ';'
+// Only ControlConnectServer takes parameters, which must then be provided in server
+func EncodeTerminalControl(command uint8, server *ServerConnection) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{command})
+	switch command {
+	case ControlConnectServer:
+		if server == nil {
+			return nil, fmt.Errorf("server is required")
+		}
+		// Parameters may not contain the separator
+		fields := []string{server.AuthCode, server.APN, server.Username, server.Password, server.Address}
+		for _, f := range fields {
+			if strings.Contains(f, ";") {
+				return nil, fmt.Errorf("server parameters may not contain ';'")
+			}
+		}
+		params := []string{fmt.Sprint(connectionControlSpecified)}
+		params = append(params, fields...)
+		params = append(params, fmt.Sprint(server.TCPPort), fmt.Sprint(server.UDPPort), fmt.Sprint(server.TimeLimit))
+		buf.WriteString(strings.Join(params, ";"))
+	case ControlReset, ControlFactoryReset, ControlCloseDataLink, ControlCloseRadio:
+	default:
+		return nil, fmt.Errorf("unsupported control command: %v", command)
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode temporary location tracking control message body
+// Body is interval(2) in seconds and validity(4) in seconds. An interval of 0 stops tracking
+func EncodeTempTracking(interval uint16, validity uint32) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	binary.Write(buf, binary.BigEndian, interval)
+	binary.Write(buf, binary.BigEndian, validity)
+	return buf.Bytes()
+}
@@ -0,0 +1,101 @@
+package jt808
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Driver identity statuses
+const (
+	DriverCardInserted uint8 = 0x01
+	DriverCardRemoved  uint8 = 0x02
+)
+
+// IC card read results
+const (
+	CardReadSuccess     uint8 = 0x00
+	CardReadAuthFailure uint8 = 0x01
+	CardReadLocked      uint8 = 0x02
+	CardReadRemoved     uint8 = 0x03
+	CardReadCheckError  uint8 = 0x04
+)
+
+const (
+	certificateLength int = 20
+	idNumberLength    int = 20
+)
+
+// Driver identity reported when an IC card is inserted or removed
+// Driver details are only set when a card is inserted and read successfully
+// CertificateExpiry is formatted as YYYY-MM-DD, and IdNumber is only reported by JT808-2019 terminals
+type DriverIdentity struct {
+	Status            uint8
+	Timestamp         int64
+	ReadResult        uint8
+	Name              string
+	Certificate       string
+	Agency            string
+	CertificateExpiry string
+	IdNumber          string
+}
+
+// Parse driver identity report
+// Body is status(1) and time(6). Inserted cards are followed by read result(1), and if read successfully
+// name length(1), name, certificate(20), agency length(1), agency, certificate expiry(4) and in JT808-2019 id number(20)
+func ParseDriverIdentity(payload []byte, version uint8) (DriverIdentity, error) {
+	var d DriverIdentity
+	if len(payload) < 7 {
+		return d, fmt.Errorf("driver identity too short: %v bytes", len(payload))
+	}
+	d.Status = payload[0]
+	d.Timestamp = parseBCDTime(payload[1:7])
+	if d.Status != DriverCardInserted {
+		return d, nil
+	}
+	if len(payload) < 8 {
+		return d, fmt.Errorf("driver identity is missing read result")
+	}
+	d.ReadResult = payload[7]
+	if d.ReadResult != CardReadSuccess {
+		return d, nil
+	}
+	offset := 8
+	if len(payload) < offset+1 {
+		return d, fmt.Errorf("driver identity is missing name")
+	}
+	nameLen := int(payload[offset])
+	offset++
+	if len(payload) < offset+nameLen+certificateLength+1 {
+		return d, fmt.Errorf("driver identity too short for name of %v bytes", nameLen)
+	}
+	d.Name = decodeGBK(payload[offset : offset+nameLen])
+	offset += nameLen
+	d.Certificate = parseRegistrationString(payload[offset : offset+certificateLength])
+	offset += certificateLength
+	agencyLen := int(payload[offset])
+	offset++
+	if len(payload) < offset+agencyLen+4 {
+		return d, fmt.Errorf("driver identity too short for agency of %v bytes", agencyLen)
+	}
+	d.Agency = decodeGBK(payload[offset : offset+agencyLen])
+	offset += agencyLen
+	expiry := payload[offset : offset+4]
+	d.CertificateExpiry = fmt.Sprintf("%02d%02d-%02d-%02d", fromBCD(expiry[0]), fromBCD(expiry[1]), fromBCD(expiry[2]), fromBCD(expiry[3]))
+	offset += 4
+	if version != Version2013 && len(payload) >= offset+idNumberLength {
+		d.IdNumber = parseRegistrationString(payload[offset : offset+idNumberLength])
+	}
+	return d, nil
+}
+
+// Decode GBK encoded string, falling back to the raw bytes if it is not valid GBK
+func decodeGBK(b []byte) string {
+	b = bytes.TrimRight(b, "\x00")
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(decoded)
+}
@@ -0,0 +1,44 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"banjo.dev/trackerr/internal/model"
+)
+
+// Upgrade results reported by terminals
+const (
+	UpgradeSuccess   uint8 = 0
+	UpgradeFailure   uint8 = 1
+	UpgradeCancelled uint8 = 2
+)
+
+// Encode upgrade package message body
+// Body is type(1), manufacturer id(5), version length(1), version, data length(4) and data
+// The manufacturer id is 11 bytes in JT808-2019
+func EncodeUpgrade(f model.Firmware, data []byte, version uint8) []byte {
+	manufacturerLen := 5
+	if version != Version2013 {
+		manufacturerLen = 11
+	}
+	manufacturer := make([]byte, manufacturerLen)
+	copy(manufacturer, f.ManufacturerId)
+	buf := bytes.NewBuffer([]byte{f.Type})
+	buf.Write(manufacturer)
+	buf.WriteByte(byte(len(f.Version)))
+	buf.WriteString(f.Version)
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// Parse upgrade result notification
+// Body is type(1) and result(1)
+func ParseUpgradeResult(payload []byte) (uint8, uint8, error) {
+	if len(payload) < 2 {
+		return 0, 0, fmt.Errorf("upgrade result too short: %v bytes", len(payload))
+	}
+	return payload[0], payload[1], nil
+}
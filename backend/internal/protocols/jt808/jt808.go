@@ -10,6 +10,7 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"banjo.dev/trackerr/internal/database"
@@ -27,29 +28,71 @@ const (
 	MsgTypeLogout               uint16        = 0x0003
 	MsgTypeRegistrion           uint16        = 0x0100
 	MsgTypeAuth                 uint16        = 0x0102
+	MsgTypeQueryParamsRes       uint16        = 0x0104
+	MsgTypeUpgradeResult        uint16        = 0x0108
 	MsgTypeLocation             uint16        = 0x0200
+	MsgTypeQueryLocationRes     uint16        = 0x0201
 	MsgTypeVersionInfo          uint16        = 0x0205
+	MsgTypeDriverIdentity       uint16        = 0x0702
 	MsgTypeLocationBatch        uint16        = 0x0704
+	MsgTypeMediaEvent           uint16        = 0x0800
+	MsgTypeMediaUpload          uint16        = 0x0801
+	MsgTypeSnapshotRes          uint16        = 0x0805
 	MsgTypeUpstreamData         uint16        = 0x0900
 	MsgTypeCmdRes               uint16        = 0x6006
 	MsgTypePlatformUniversalRes uint16        = 0x8001
+	MsgTypeRetransmissionReq    uint16        = 0x8003
 	MsgTypeTermRegistrationRes  uint16        = 0x8100
+	MsgTypeSetParams            uint16        = 0x8103
+	MsgTypeQueryParams          uint16        = 0x8104
+	MsgTypeTermControl          uint16        = 0x8105
+	MsgTypeQuerySpecificParams  uint16        = 0x8106
+	MsgTypeUpgrade              uint16        = 0x8108
+	MsgTypeQueryLocation        uint16        = 0x8201
+	MsgTypeTempTracking         uint16        = 0x8202
+	MsgTypeAlarmAck             uint16        = 0x8203
 	MsgTypeVersionInfoRes       uint16        = 0x8205
 	MsgTypeCmdSend              uint16        = 0x8300
+	MsgTypeSetCircleRegion      uint16        = 0x8600
+	MsgTypeDeleteCircleRegion   uint16        = 0x8601
+	MsgTypeSetRectRegion        uint16        = 0x8602
+	MsgTypeDeleteRectRegion     uint16        = 0x8603
+	MsgTypeSetPolygonRegion     uint16        = 0x8604
+	MsgTypeDeletePolygonRegion  uint16        = 0x8605
+	MsgTypeSetRoute             uint16        = 0x8606
+	MsgTypeDeleteRoute          uint16        = 0x8607
+	MsgTypeMediaUploadRes       uint16        = 0x8800
+	MsgTypeSnapshot             uint16        = 0x8801
+	MsgTypeDownstreamData       uint16        = 0x8900
 	ResultSuccess               uint8         = 0x00
 	ResultFailure               uint8         = 0x01
 	ResultIncorrectInformation  uint8         = 0x02
 	NotSupporting               uint8         = 0x03
 	AlarmProcessingConfirmation uint8         = 0x04
 	HeartbeatInterval           time.Duration = 5 * time.Minute
+	AttrLengthMask              uint16        = 0x03FF
+	AttrSubPackageFlag          uint16        = 1 << 13
+	AttrVersionFlag             uint16        = 1 << 14
+	Version2013                 uint8         = 0
+	trackerIdLength             int           = 12
+	StatusSouthLatitude         uint32        = 1 << 2
+	StatusWestLongitude         uint32        = 1 << 3
+	InfoMileage                 uint8         = 0x01
+	InfoFuel                    uint8         = 0x02
+	InfoRecorderSpeed           uint8         = 0x03
+	InfoSignalStrength          uint8         = 0x30
+	InfoSatellites              uint8         = 0x31
+	BatchTypeBlindArea          uint8         = 0x01
 )
 
 // Perform authentication and registration
-func PerformAuth(conn net.Conn, p model.Packet) (string, error) {
+// Returns the tracker id and the protocol version used by the tracker
+func PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
 	// Abort if first packet is not registration nor authentication
 	if p.PacketType != MsgTypeRegistrion && p.PacketType != MsgTypeAuth {
-		return "", fmt.Errorf("expected registration or authentication request but received: %v", p.PacketType)
+		return "", 0, fmt.Errorf("expected registration or authentication request but received: %v", p.PacketType)
 	}
+	version := p.Version
 
 	var buf *bytes.Buffer
 	trackerID := p.DeviceID
@@ -61,33 +104,54 @@ func PerformAuth(conn net.Conn, p model.Packet) (string, error) {
 		buf = bytes.NewBuffer([]byte{})
 		binary.Write(buf, binary.BigEndian, p.SerialNumber)
 
+		// Save registration details, so it can be audited which terminal connected
+		reg, err := ParseRegistrationMsg(p.Payload, version)
+		if err != nil {
+			log.Printf("%v: Failed to parse registration: %v\n", trackerID, err)
+		} else {
+			reg.TrackerId = trackerID
+			reg.Timestamp = time.Now().Unix()
+			if err := database.SaveRegistration(reg); err != nil {
+				log.Printf("%v: Error: %v\n", trackerID, err)
+			}
+			// Verify that the terminal model matches the model the tracker is registered with
+			if t, err := database.GetTracker(trackerID); err == nil && !ModelMatches(reg, t.Model) {
+				log.Printf("%v: Terminal model %v does not match registered model %v\n", trackerID, reg.TerminalModel, t.Model)
+				if VerifyModel {
+					buf.WriteByte(RegistrationNoSuchTerminal)
+					SendMsg(conn, MsgTypeTermRegistrationRes, buf.Bytes(), 0, trackerID, version)
+					return "", 0, fmt.Errorf("terminal model %v does not match registered model %v", reg.TerminalModel, t.Model)
+				}
+			}
+		}
+
 		// Save generated authcode to database
 		encodedCode := b64.StdEncoding.EncodeToString(authcode)
-		err := database.SaveAuthCode(model.AuthCode{TrackerId: trackerID, Code: encodedCode})
+		err = database.SaveAuthCode(model.AuthCode{TrackerId: trackerID, Code: encodedCode})
 		if err != nil {
 			// Create and send failed registration response
-			buf.WriteByte(2)
+			buf.WriteByte(RegistrationNoSuchVehicle)
 			//buf.Write(authcode)
 
-			SendMsg(conn, MsgTypeTermRegistrationRes, buf.Bytes(), 0, trackerID)
-			return "", fmt.Errorf("failed to store auth code in database. this may be because tracker %v it is not registered", trackerID)
+			SendMsg(conn, MsgTypeTermRegistrationRes, buf.Bytes(), 0, trackerID, version)
+			return "", 0, fmt.Errorf("failed to store auth code in database. this may be because tracker %v it is not registered", trackerID)
 		}
 
 		// Create and send registration response
-		buf.WriteByte(0)
+		buf.WriteByte(RegistrationSuccess)
 		buf.Write(authcode)
 
-		SendMsg(conn, MsgTypeTermRegistrationRes, buf.Bytes(), 0, trackerID)
+		SendMsg(conn, MsgTypeTermRegistrationRes, buf.Bytes(), 0, trackerID, version)
 
 		// Try to read authentication message
 		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 		utils.ReadBytes(conn, 1) // skip start byte
 		p, err = ParseMsg(conn, utils.NullTime{Time: 60 * time.Second, IsSet: true})
 		if err != nil {
-			return "", fmt.Errorf("failed to parse authentication request")
+			return "", 0, fmt.Errorf("failed to parse authentication request")
 		}
 		if p.PacketType != MsgTypeAuth {
-			return "", fmt.Errorf("expected authentication request packet but received: %v", p.PacketType)
+			return "", 0, fmt.Errorf("expected authentication request packet but received: %v", p.PacketType)
 		}
 	} else {
 		// Received authentication message
@@ -95,21 +159,33 @@ func PerformAuth(conn net.Conn, p model.Packet) (string, error) {
 		ac, err := database.FetchAuthCode(trackerID)
 		// Send response indicating incorrect information
 		if err != nil {
-			SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultIncorrectInformation, trackerID)
-			return "", fmt.Errorf("failed to fetch auth code for %v: %v", trackerID, err)
+			SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultIncorrectInformation, trackerID, version)
+			return "", 0, fmt.Errorf("failed to fetch auth code for %v: %v", trackerID, err)
 		}
 		authcode, _ = b64.StdEncoding.DecodeString(ac.Code)
 	}
 
 	// Indicate failure if authcode does not match
-	if !bytes.Equal(authcode, p.Payload) {
+	if !bytes.Equal(authcode, parseAuthCode(p)) {
 		log.Println("received wrong auth code")
-		SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultFailure, trackerID)
-		return "", fmt.Errorf("received wrong auth code")
+		SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultFailure, trackerID, version)
+		return "", 0, fmt.Errorf("received wrong auth code")
 	}
 	log.Println("Received valid authcode from device")
-	SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultSuccess, trackerID)
-	return trackerID, nil
+	SendUniversalRes(conn, MsgTypeAuth, p.SerialNumber, ResultSuccess, trackerID, version)
+	return trackerID, version, nil
+}
+
+// Get auth code from authentication message
+// JT808-2013 sends only the auth code, while JT808-2019 sends length(1), auth code(length), IMEI(15) and software version(20)
+func parseAuthCode(p model.Packet) []byte {
+	if p.Version == Version2013 {
+		return p.Payload
+	}
+	if len(p.Payload) < 1 || len(p.Payload) < 1+int(p.Payload[0]) {
+		return nil
+	}
+	return p.Payload[1 : 1+int(p.Payload[0])]
 }
 
 // Parse JT808 message
@@ -120,16 +196,48 @@ func ParseMsg(conn net.Conn, maxWait utils.NullTime) (model.Packet, error) {
 	if maxWait.IsSet {
 		conn.SetReadDeadline(time.Now().Add(maxWait.Time))
 	}
-	header, err := readBytesAndEscape(conn, 12)
+	header, err := readBytesAndEscape(conn, 4)
 	if err != nil {
 		return p, fmt.Errorf("failed to read header: %v", err)
 	}
 
 	// Map message id as packet type
 	p.PacketType = binary.BigEndian.Uint16(header[0:2])
-	p.PayloadLength = binary.BigEndian.Uint16(header[2:4]) & 0b1111111111
-	p.DeviceID = hex.EncodeToString(header[4:10])
-	p.SerialNumber = binary.BigEndian.Uint16(header[10:12])
+	attributes := binary.BigEndian.Uint16(header[2:4])
+	p.PayloadLength = attributes & AttrLengthMask
+
+	// JT808-2019 headers contain protocol version(1), phone(10) and serial(2)
+	// JT808-2013 headers contain phone(6) and serial(2)
+	if attributes&AttrVersionFlag != 0 {
+		rest, err := readBytesAndEscape(conn, 13)
+		if err != nil {
+			return p, fmt.Errorf("failed to read header: %v", err)
+		}
+		header = append(header, rest...)
+		p.Version = rest[0]
+		p.DeviceID = phoneToTrackerId(hex.EncodeToString(rest[1:11]))
+		p.SerialNumber = binary.BigEndian.Uint16(rest[11:13])
+	} else {
+		rest, err := readBytesAndEscape(conn, 8)
+		if err != nil {
+			return p, fmt.Errorf("failed to read header: %v", err)
+		}
+		header = append(header, rest...)
+		p.Version = Version2013
+		p.DeviceID = hex.EncodeToString(rest[0:6])
+		p.SerialNumber = binary.BigEndian.Uint16(rest[6:8])
+	}
+
+	// Sub-packaged messages have package count(2) and package index(2) after the serial
+	if attributes&AttrSubPackageFlag != 0 {
+		pkg, err := readBytesAndEscape(conn, 4)
+		if err != nil {
+			return p, fmt.Errorf("failed to read package fields: %v", err)
+		}
+		header = append(header, pkg...)
+		p.PackageCount = binary.BigEndian.Uint16(pkg[0:2])
+		p.PackageIndex = binary.BigEndian.Uint16(pkg[2:4])
+	}
 
 	// Read payload
 	p.Payload, err = readBytesAndEscape(conn, int(p.PayloadLength))
@@ -163,14 +271,126 @@ func ParseMsg(conn net.Conn, maxWait utils.NullTime) (model.Packet, error) {
 }
 
 // Parse location message
-func ParseLocationMsg(payload []byte) model.Locationdata {
+// Body is alarm flags(4), status(4), lat(4), lon(4), altitude(2), speed(2), heading(2), time(6),
+// followed by additional information items of id(1), length(1), value(length)
+func ParseLocationMsg(payload []byte) (model.Locationdata, error) {
+	if len(payload) < 28 {
+		return model.Locationdata{}, fmt.Errorf("location payload too short: %v bytes", len(payload))
+	}
+	status := binary.BigEndian.Uint32(payload[4:8])
 	locationBytes := payload[8:22]
-	return model.Locationdata{
-		Lat:     binary.BigEndian.Uint32(locationBytes[0:4]),
-		Lon:     binary.BigEndian.Uint32(locationBytes[4:8]),
-		Speed:   binary.BigEndian.Uint16(locationBytes[10:12]),
-		Heading: binary.BigEndian.Uint16(locationBytes[12:14]),
+	ld := model.Locationdata{
+		AlarmFlags: binary.BigEndian.Uint32(payload[0:4]),
+		Status:     status,
+		Timestamp:  parseBCDTime(payload[22:28]),
+		Lat:        int32(binary.BigEndian.Uint32(locationBytes[0:4])),
+		Lon:        int32(binary.BigEndian.Uint32(locationBytes[4:8])),
+		Altitude:   binary.BigEndian.Uint16(locationBytes[8:10]),
+		Speed:      binary.BigEndian.Uint16(locationBytes[10:12]),
+		Heading:    binary.BigEndian.Uint16(locationBytes[12:14]),
+	}
+	// Status bit 2 is set for southern latitude and bit 3 is set for western longitude
+	if status&StatusSouthLatitude != 0 {
+		ld.Lat = -ld.Lat
+	}
+	if status&StatusWestLongitude != 0 {
+		ld.Lon = -ld.Lon
+	}
+	if len(payload) > 28 {
+		ld.AdditionalInfo = payload[28:]
+		parseAdditionalInfo(&ld, payload[28:])
+	}
+	return ld, nil
+}
+
+// Parse batch location message
+// Body is count(2), type(1), followed by count items of length(2), location body(length)
+// Type is 0 for regular batch reports and 1 for positions buffered in blind areas
+func ParseLocationBatchMsg(payload []byte) ([]model.Locationdata, error) {
+	if len(payload) < 3 {
+		return nil, fmt.Errorf("batch payload too short: %v bytes", len(payload))
+	}
+	count := int(binary.BigEndian.Uint16(payload[0:2]))
+	historic := payload[2] == BatchTypeBlindArea
+	lds := make([]model.Locationdata, 0, count)
+	offset := 3
+	for n := 0; n < count; n++ {
+		if offset+2 > len(payload) {
+			return lds, fmt.Errorf("batch contains %v of %v expected items", n, count)
+		}
+		length := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
+		offset += 2
+		if offset+length > len(payload) {
+			return lds, fmt.Errorf("batch item %v exceeds payload", n)
+		}
+		ld, err := ParseLocationMsg(payload[offset : offset+length])
+		offset += length
+		if err != nil {
+			return lds, fmt.Errorf("batch item %v: %v", n, err)
+		}
+		ld.Historic = historic
+		lds = append(lds, ld)
+	}
+	return lds, nil
+}
+
+// Decode the known additional information items into ld
+// Unknown items are skipped, but remain available in ld.AdditionalInfo
+func parseAdditionalInfo(ld *model.Locationdata, items []byte) {
+	for i := 0; i+2 <= len(items); {
+		id := items[i]
+		length := int(items[i+1])
+		i += 2
+		if i+length > len(items) {
+			log.Printf("additional information item %#x exceeds payload\n", id)
+			return
+		}
+		value := items[i : i+length]
+		i += length
+		switch {
+		case id == InfoMileage && length == 4:
+			mileage := binary.BigEndian.Uint32(value)
+			ld.Mileage = &mileage
+		case id == InfoFuel && length == 2:
+			fuel := binary.BigEndian.Uint16(value)
+			ld.Fuel = &fuel
+		case id == InfoRecorderSpeed && length == 2:
+			speed := binary.BigEndian.Uint16(value)
+			ld.RecorderSpeed = &speed
+		case id == InfoSignalStrength && length == 1:
+			signal := value[0]
+			ld.SignalStrength = &signal
+		case id == InfoSatellites && length == 1:
+			satellites := value[0]
+			ld.Satellites = &satellites
+		}
+	}
+}
+
+// Parse serial number of the platform message a terminal response replies to
+func ParseReplySerial(payload []byte) (uint16, error) {
+	if len(payload) < 2 {
+		return 0, fmt.Errorf("response payload too short: %v bytes", len(payload))
+	}
+	return binary.BigEndian.Uint16(payload[0:2]), nil
+}
+
+// Parse position information query response
+// Body is reply serial(2), followed by a location report body
+func ParseQueryLocationRes(payload []byte) (model.Locationdata, error) {
+	if len(payload) < 2 {
+		return model.Locationdata{}, fmt.Errorf("position query response too short: %v bytes", len(payload))
+	}
+	return ParseLocationMsg(payload[2:])
+}
+
+// Parse terminal universal response
+// Body is reply serial(2), reply message id(2), result(1)
+func ParseUniversalRes(payload []byte) (uint16, uint16, uint8, error) {
+	if len(payload) < 5 {
+		return 0, 0, 0, fmt.Errorf("universal response too short: %v bytes", len(payload))
 	}
+	return binary.BigEndian.Uint16(payload[0:2]), binary.BigEndian.Uint16(payload[2:4]), payload[4], nil
 }
 
 // Parse command response
@@ -178,21 +398,43 @@ func ParseCmdRes(payload []byte) string {
 	return string(payload[7:])
 }
 
-// Send JT808 specific message
-func SendMsg(conn net.Conn, msgtype uint16, payload []byte, serialnum uint16, trackerID string) {
+// Send JT808 specific message, using the header format of version
+func SendMsg(conn net.Conn, msgtype uint16, payload []byte, serialnum uint16, trackerID string, version uint8) {
+	sendMsg(conn, msgtype, payload, serialnum, trackerID, version, 0, 0)
+}
+
+// Send message, which is sub-package index of count if count is not 0
+func sendMsg(conn net.Conn, msgtype uint16, payload []byte, serialnum uint16, trackerID string, version uint8, count uint16, index uint16) {
 	buf := bytes.NewBuffer([]byte{})
 	// Write start byte
 	buf.Write([]byte{0x7e})
 	// Map msgtype to message id
 	binary.Write(buf, binary.BigEndian, msgtype)
-	// Write body attribute
-	binary.Write(buf, binary.BigEndian, uint16(len(payload)))
-	// Write trackerID - MUST BE MAPPED TO PARAMETER
-	id, _ := hex.DecodeString(trackerID)
-	buf.Write(id)
-	//binary.Write(buf,binary.BigEndian,[]byte{0x01,0x63,0x70,0x57,0x75,0x06})
+	attributes := uint16(len(payload))
+	if count != 0 {
+		attributes |= AttrSubPackageFlag
+	}
+	if version == Version2013 {
+		// Write body attribute
+		binary.Write(buf, binary.BigEndian, attributes)
+		// Write trackerID as 6 byte BCD phone
+		id, _ := hex.DecodeString(trackerID)
+		buf.Write(id)
+	} else {
+		// Write body attribute with version flag, followed by protocol version
+		binary.Write(buf, binary.BigEndian, attributes|AttrVersionFlag)
+		buf.WriteByte(version)
+		// Write trackerID as 10 byte BCD phone
+		id, _ := hex.DecodeString(strings.Repeat("0", 20-len(trackerID)) + trackerID)
+		buf.Write(id)
+	}
 	// Write Serial number
 	binary.Write(buf, binary.BigEndian, serialnum)
+	// Write package count and index of sub-packages
+	if count != 0 {
+		binary.Write(buf, binary.BigEndian, count)
+		binary.Write(buf, binary.BigEndian, index)
+	}
 	// Write payload
 	buf.Write(payload)
 	// Write error check code
@@ -206,19 +448,29 @@ func SendMsg(conn net.Conn, msgtype uint16, payload []byte, serialnum uint16, tr
 }
 
 // Send jt808 upstream command
-func SendCmd(conn net.Conn, payload string, tid string, serialNumber uint16) {
+func SendCmd(conn net.Conn, payload string, tid string, serialNumber uint16, version uint8) {
 	cmdbuf := bytes.NewBuffer([]byte{0x01})
 	cmdbuf.Write([]byte(payload))
-	SendMsg(conn, MsgTypeCmdSend, cmdbuf.Bytes(), serialNumber, tid)
+	SendMsg(conn, MsgTypeCmdSend, cmdbuf.Bytes(), serialNumber, tid, version)
 }
 
 // Send platform universal response
-func SendUniversalRes(conn net.Conn, packetType uint16, serialNumber uint16, result uint8, tid string) {
+func SendUniversalRes(conn net.Conn, packetType uint16, serialNumber uint16, result uint8, tid string, version uint8) {
 	payload := bytes.NewBuffer([]byte{})
 	binary.Write(payload, binary.BigEndian, serialNumber)
 	binary.Write(payload, binary.BigEndian, packetType)
 	payload.WriteByte(result)
-	SendMsg(conn, MsgTypePlatformUniversalRes, payload.Bytes(), 0, tid)
+	SendMsg(conn, MsgTypePlatformUniversalRes, payload.Bytes(), 0, tid, version)
+}
+
+// Convert JT808-2019 20 digit phone to tracker id
+// Leading zeros are removed, while keeping at least the 12 digits used by JT808-2013
+func phoneToTrackerId(phone string) string {
+	id := strings.TrimLeft(phone, "0")
+	if len(id) < trackerIdLength {
+		id = strings.Repeat("0", trackerIdLength-len(id)) + id
+	}
+	return id
 }
 
 // Wrapper of readBytes which includes the JT808 escape process
@@ -295,6 +547,29 @@ func GetCNTimeAsBCD() []byte {
 	}
 }
 
+// Convert UTC+8 time from BCD [yy,mm,dd,hh,mm,ss] to unix time
+// Returns 0 if the time is not set, which is the case when the device has no fix
+func parseBCDTime(timeBytes []byte) int64 {
+	if bytes.Equal(timeBytes, make([]byte, 6)) {
+		return 0
+	}
+	tz := time.FixedZone("UTC+8", 8*60*60)
+	return time.Date(
+		2000+fromBCD(timeBytes[0]),
+		time.Month(fromBCD(timeBytes[1])),
+		fromBCD(timeBytes[2]),
+		fromBCD(timeBytes[3]),
+		fromBCD(timeBytes[4]),
+		fromBCD(timeBytes[5]),
+		0, tz).Unix()
+}
+
+// Convert BCD to int
+// Example 0x12 -> 12
+func fromBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0f)
+}
+
 // Convert int to BCD
 // Example 12 -> 0x12
 func toBCD(n int) byte {
@@ -0,0 +1,149 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"banjo.dev/trackerr/internal/model"
+)
+
+// Multimedia types
+const (
+	MediaTypeImage uint8 = 0
+	MediaTypeAudio uint8 = 1
+	MediaTypeVideo uint8 = 2
+)
+
+var mediaTypeNames = map[uint8]string{
+	MediaTypeImage: "image",
+	MediaTypeAudio: "audio",
+	MediaTypeVideo: "video",
+}
+
+// File extensions of multimedia formats
+var mediaExtensions = map[uint8]string{
+	0: "jpg",
+	1: "tif",
+	2: "mp3",
+	3: "wav",
+	4: "wmv",
+}
+
+// Snapshot shooting command values for stopping and recording video
+const (
+	SnapshotStop   uint16 = 0x0000
+	SnapshotRecord uint16 = 0xFFFF
+)
+
+// Snapshot command parameters
+// Count is the number of photos, or SnapshotStop/SnapshotRecord. Interval is in seconds between photos or recording time
+// Resolution ranges from 1 (320x240) to 8 (704x576), Quality from 1 (best) to 10 and the image settings from 0 to 255
+type Snapshot struct {
+	Channel    uint8
+	Count      uint16
+	Interval   uint16
+	Save       bool // Save on terminal instead of uploading
+	Resolution uint8
+	Quality    uint8
+	Brightness uint8
+	Contrast   uint8
+	Saturation uint8
+	Chroma     uint8
+}
+
+// Get name of multimedia type
+func MediaTypeName(t uint8) string {
+	if name, ok := mediaTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Get file extension of multimedia format
+func MediaExtension(format uint8) string {
+	if ext, ok := mediaExtensions[format]; ok {
+		return ext
+	}
+	return "bin"
+}
+
+// Parse multimedia event message
+// Body is media id(4), type(1), format(1), event(1), channel(1)
+func ParseMediaEvent(payload []byte) (model.Media, error) {
+	if len(payload) < 8 {
+		return model.Media{}, fmt.Errorf("multimedia event too short: %v bytes", len(payload))
+	}
+	return model.Media{
+		MediaId: binary.BigEndian.Uint32(payload[0:4]),
+		Type:    payload[4],
+		Format:  payload[5],
+		Event:   payload[6],
+		Channel: payload[7],
+	}, nil
+}
+
+// Parse multimedia data upload message
+// Body is the multimedia event body, followed by location report basic information(28) and the data
+func ParseMediaUpload(payload []byte) (model.Media, model.Locationdata, []byte, error) {
+	var ld model.Locationdata
+	m, err := ParseMediaEvent(payload)
+	if err != nil {
+		return m, ld, nil, err
+	}
+	if len(payload) < 36 {
+		return m, ld, nil, fmt.Errorf("multimedia upload too short: %v bytes", len(payload))
+	}
+	ld, err = ParseLocationMsg(payload[8:36])
+	if err != nil {
+		return m, ld, nil, err
+	}
+	return m, ld, payload[36:], nil
+}
+
+// Encode multimedia data upload response body
+// Body is media id(4), count(1), followed by ids of packages to retransmit(2 each). A count of 0 acknowledges the upload
+func EncodeMediaUploadRes(mediaId uint32, missing []uint16) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	binary.Write(buf, binary.BigEndian, mediaId)
+	buf.WriteByte(byte(len(missing)))
+	for _, index := range missing {
+		binary.Write(buf, binary.BigEndian, index)
+	}
+	return buf.Bytes()
+}
+
+// Encode snapshot command body
+// Body is channel(1), count(2), interval(2), save flag(1), resolution(1), quality(1), brightness(1), contrast(1), saturation(1), chroma(1)
+func EncodeSnapshot(s Snapshot) []byte {
+	buf := bytes.NewBuffer([]byte{s.Channel})
+	binary.Write(buf, binary.BigEndian, s.Count)
+	binary.Write(buf, binary.BigEndian, s.Interval)
+	save := byte(0)
+	if s.Save {
+		save = 1
+	}
+	buf.Write([]byte{save, s.Resolution, s.Quality, s.Brightness, s.Contrast, s.Saturation, s.Chroma})
+	return buf.Bytes()
+}
+
+// Parse snapshot command response
+// Body is reply serial(2), result(1), count(2), followed by media ids(4 each)
+func ParseSnapshotRes(payload []byte) (uint8, []uint32, error) {
+	if len(payload) < 3 {
+		return 0, nil, fmt.Errorf("snapshot response too short: %v bytes", len(payload))
+	}
+	result := payload[2]
+	if result != ResultSuccess || len(payload) < 5 {
+		return result, nil, nil
+	}
+	count := int(binary.BigEndian.Uint16(payload[3:5]))
+	if len(payload) < 5+4*count {
+		return result, nil, fmt.Errorf("snapshot response contains fewer than %v media ids", count)
+	}
+	ids := make([]uint32, count)
+	for i := range ids {
+		ids[i] = binary.BigEndian.Uint32(payload[5+4*i : 9+4*i])
+	}
+	return result, ids, nil
+}
@@ -0,0 +1,137 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Terminal parameter IDs
+const (
+	ParamHeartbeatInterval  uint32 = 0x0001
+	ParamAPN                uint32 = 0x0010
+	ParamServerAddress      uint32 = 0x0013
+	ParamServerPort         uint32 = 0x0018
+	ParamReportInterval     uint32 = 0x0029
+	ParamOverspeedThreshold uint32 = 0x0055
+)
+
+// Terminal parameters supported by the API
+// Fields are nil if not set or not reported by the terminal
+type Parameters struct {
+	HeartbeatInterval  *uint32 // Seconds
+	ReportInterval     *uint32 // Seconds
+	ServerAddress      *string // IP address or domain
+	ServerPort         *uint32 // TCP port
+	APN                *string
+	OverspeedThreshold *uint32 // km/h
+}
+
+// IDs of all parameters in Parameters
+var ParameterIds = []uint32{
+	ParamHeartbeatInterval,
+	ParamReportInterval,
+	ParamServerAddress,
+	ParamServerPort,
+	ParamAPN,
+	ParamOverspeedThreshold,
+}
+
+// Encode set terminal parameters message body
+// Body is count(1), followed by items of id(4), length(1), value(length)
+func EncodeSetParams(p Parameters) []byte {
+	items := bytes.NewBuffer([]byte{})
+	count := 0
+	writeDword := func(id uint32, v *uint32) {
+		if v == nil {
+			return
+		}
+		binary.Write(items, binary.BigEndian, id)
+		items.WriteByte(4)
+		binary.Write(items, binary.BigEndian, *v)
+		count++
+	}
+	writeString := func(id uint32, v *string) {
+		if v == nil {
+			return
+		}
+		binary.Write(items, binary.BigEndian, id)
+		items.WriteByte(byte(len(*v)))
+		items.WriteString(*v)
+		count++
+	}
+	writeDword(ParamHeartbeatInterval, p.HeartbeatInterval)
+	writeDword(ParamReportInterval, p.ReportInterval)
+	writeString(ParamServerAddress, p.ServerAddress)
+	writeDword(ParamServerPort, p.ServerPort)
+	writeString(ParamAPN, p.APN)
+	writeDword(ParamOverspeedThreshold, p.OverspeedThreshold)
+	return append([]byte{byte(count)}, items.Bytes()...)
+}
+
+// Get message type and body for querying terminal parameters
+// All parameters are queried with 0x8104 if ids is empty, otherwise the specified ones with 0x8106
+func EncodeQueryParams(ids []uint32) (uint16, []byte) {
+	if len(ids) == 0 {
+		return MsgTypeQueryParams, []byte{}
+	}
+	buf := bytes.NewBuffer([]byte{byte(len(ids))})
+	for _, id := range ids {
+		binary.Write(buf, binary.BigEndian, id)
+	}
+	return MsgTypeQuerySpecificParams, buf.Bytes()
+}
+
+// Parse query terminal parameters response
+// Body is reply serial(2), count(1), followed by items of id(4), length(1), value(length)
+// Parameters not in Parameters are ignored
+func ParseQueryParamsRes(payload []byte) (Parameters, error) {
+	var p Parameters
+	if len(payload) < 3 {
+		return p, fmt.Errorf("parameter response too short: %v bytes", len(payload))
+	}
+	count := int(payload[2])
+	offset := 3
+	for n := 0; n < count; n++ {
+		if offset+5 > len(payload) {
+			return p, fmt.Errorf("parameter response contains %v of %v expected items", n, count)
+		}
+		id := binary.BigEndian.Uint32(payload[offset : offset+4])
+		length := int(payload[offset+4])
+		offset += 5
+		if offset+length > len(payload) {
+			return p, fmt.Errorf("parameter %#x exceeds payload", id)
+		}
+		value := payload[offset : offset+length]
+		offset += length
+		switch id {
+		case ParamHeartbeatInterval:
+			p.HeartbeatInterval = parseDwordParam(value)
+		case ParamReportInterval:
+			p.ReportInterval = parseDwordParam(value)
+		case ParamServerAddress:
+			p.ServerAddress = parseStringParam(value)
+		case ParamServerPort:
+			p.ServerPort = parseDwordParam(value)
+		case ParamAPN:
+			p.APN = parseStringParam(value)
+		case ParamOverspeedThreshold:
+			p.OverspeedThreshold = parseDwordParam(value)
+		}
+	}
+	return p, nil
+}
+
+func parseDwordParam(value []byte) *uint32 {
+	if len(value) != 4 {
+		return nil
+	}
+	v := binary.BigEndian.Uint32(value)
+	return &v
+}
+
+func parseStringParam(value []byte) *string {
+	// Strings may be terminated with 0x00
+	v := string(bytes.TrimRight(value, "\x00"))
+	return &v
+}
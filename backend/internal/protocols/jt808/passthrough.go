@@ -0,0 +1,44 @@
+package jt808
+
+import (
+	"fmt"
+)
+
+// Passthrough data types
+const (
+	PassthroughGNSS        uint8 = 0x00
+	PassthroughICCard      uint8 = 0x0B
+	PassthroughSerialPort1 uint8 = 0x41
+	PassthroughSerialPort2 uint8 = 0x42
+)
+
+// Get name of passthrough data type. Types 0xF0-0xFF are user defined
+func PassthroughTypeName(passthroughType uint8) string {
+	switch {
+	case passthroughType == PassthroughGNSS:
+		return "gnss"
+	case passthroughType == PassthroughICCard:
+		return "icCard"
+	case passthroughType == PassthroughSerialPort1:
+		return "serialPort1"
+	case passthroughType == PassthroughSerialPort2:
+		return "serialPort2"
+	case passthroughType >= 0xF0:
+		return "userDefined"
+	}
+	return "unknown"
+}
+
+// Parse upstream passthrough message
+// Body is type(1) followed by the data
+func ParsePassthrough(payload []byte) (uint8, []byte, error) {
+	if len(payload) < 1 {
+		return 0, nil, fmt.Errorf("passthrough message is empty")
+	}
+	return payload[0], payload[1:], nil
+}
+
+// Encode downstream passthrough message body
+func EncodePassthrough(passthroughType uint8, data []byte) []byte {
+	return append([]byte{passthroughType}, data...)
+}
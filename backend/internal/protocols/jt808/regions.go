@@ -0,0 +1,225 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Region attribute bits
+const (
+	regionAttrSpeedLimit    uint16 = 1 << 1
+	regionAttrAlarmOnEnter  uint16 = 1 << 3
+	regionAttrAlarmOnExit   uint16 = 1 << 5
+	regionAttrSouthLatitude uint16 = 1 << 6
+	regionAttrWestLongitude uint16 = 1 << 7
+)
+
+// Route section attribute bits
+const (
+	sectionAttrSpeedLimit    uint8 = 1 << 1
+	sectionAttrSouthLatitude uint8 = 1 << 2
+	sectionAttrWestLongitude uint8 = 1 << 3
+)
+
+// Append region to the regions held by the terminal, instead of replacing them
+const regionSettingAppend uint8 = 1
+
+// Maximum number of region ids in a delete message
+const MaxDeleteRegionIds int = 125
+
+// Message types used to set and delete each region type
+var regionMsgTypes = map[string][2]uint16{
+	model.RegionTypeCircle:    {MsgTypeSetCircleRegion, MsgTypeDeleteCircleRegion},
+	model.RegionTypeRectangle: {MsgTypeSetRectRegion, MsgTypeDeleteRectRegion},
+	model.RegionTypePolygon:   {MsgTypeSetPolygonRegion, MsgTypeDeletePolygonRegion},
+	model.RegionTypeRoute:     {MsgTypeSetRoute, MsgTypeDeleteRoute},
+}
+
+// Get message type and body for setting region r on a terminal
+// The id of r is used as region id on the terminal. JT808-2019 bodies also contain a night speed limit and the region name
+func EncodeSetRegion(r model.Region, version uint8) (uint16, []byte, error) {
+	if err := validateRegion(r); err != nil {
+		return 0, nil, err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	attr := regionAttributes(r)
+	switch r.Type {
+	case model.RegionTypeCircle, model.RegionTypeRectangle:
+		// Circles and rectangles are set with setting attribute(1) and count(1) followed by the regions
+		buf.Write([]byte{regionSettingAppend, 1})
+		binary.Write(buf, binary.BigEndian, uint32(r.Id))
+		binary.Write(buf, binary.BigEndian, attr)
+		for _, p := range r.Points {
+			writeRegionPoint(buf, p)
+		}
+		if r.Type == model.RegionTypeCircle {
+			binary.Write(buf, binary.BigEndian, r.Radius)
+		}
+		writeSpeedLimit(buf, r)
+		writeNightSpeedLimit(buf, r, version)
+	case model.RegionTypePolygon:
+		binary.Write(buf, binary.BigEndian, uint32(r.Id))
+		binary.Write(buf, binary.BigEndian, attr)
+		writeSpeedLimit(buf, r)
+		binary.Write(buf, binary.BigEndian, uint16(len(r.Points)))
+		for _, p := range r.Points {
+			writeRegionPoint(buf, p)
+		}
+		// The night speed limit of polygons follows the points
+		writeNightSpeedLimit(buf, r, version)
+	case model.RegionTypeRoute:
+		// Speed limits of routes are set per section
+		binary.Write(buf, binary.BigEndian, uint32(r.Id))
+		binary.Write(buf, binary.BigEndian, attr&^regionAttrSpeedLimit)
+		binary.Write(buf, binary.BigEndian, uint16(len(r.Points)))
+		for i, p := range r.Points {
+			// Each inflection point starts the section with the same index
+			binary.Write(buf, binary.BigEndian, uint32(i))
+			binary.Write(buf, binary.BigEndian, uint32(i))
+			writeRegionPoint(buf, p)
+			buf.WriteByte(r.Width)
+			buf.WriteByte(sectionAttributes(r, p))
+			writeSpeedLimit(buf, r)
+			writeNightSpeedLimit(buf, r, version)
+		}
+	}
+	if version != Version2013 {
+		writeRegionName(buf, r.Name)
+	}
+	return regionMsgTypes[r.Type][0], buf.Bytes(), nil
+}
+
+// Get message type and body for deleting regions of regionType from a terminal
+// Body is count(1) followed by region ids(4 each). A count of 0 deletes all regions of the type
+func EncodeDeleteRegions(regionType string, ids []uint32) (uint16, []byte, error) {
+	msgTypes, ok := regionMsgTypes[regionType]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown region type: %v", regionType)
+	}
+	if len(ids) > MaxDeleteRegionIds {
+		return 0, nil, fmt.Errorf("at most %v regions can be deleted at once", MaxDeleteRegionIds)
+	}
+	buf := bytes.NewBuffer([]byte{byte(len(ids))})
+	for _, id := range ids {
+		binary.Write(buf, binary.BigEndian, id)
+	}
+	return msgTypes[1], buf.Bytes(), nil
+}
+
+// Verify that r has the number of points required by its type
+// The hemisphere of circles, rectangles and polygons is set once in the region attributes,
+// so their points must not cross the equator or the prime meridian
+func validateRegion(r model.Region) error {
+	switch r.Type {
+	case model.RegionTypeCircle:
+		if len(r.Points) != 1 || r.Radius == 0 {
+			return fmt.Errorf("circle requires a center point and a radius")
+		}
+	case model.RegionTypeRectangle:
+		if len(r.Points) != 2 {
+			return fmt.Errorf("rectangle requires a top-left and a bottom-right point")
+		}
+		if !sameHemisphere(r.Points) {
+			return fmt.Errorf("rectangle must not cross the equator or the prime meridian")
+		}
+	case model.RegionTypePolygon:
+		if len(r.Points) < 3 {
+			return fmt.Errorf("polygon requires at least 3 points")
+		}
+		if !sameHemisphere(r.Points) {
+			return fmt.Errorf("polygon must not cross the equator or the prime meridian")
+		}
+	case model.RegionTypeRoute:
+		if len(r.Points) < 2 || r.Width == 0 {
+			return fmt.Errorf("route requires at least 2 points and a width")
+		}
+	default:
+		return fmt.Errorf("unknown region type: %v", r.Type)
+	}
+	return nil
+}
+
+// Check if all points are in the same hemisphere, both north-south and east-west
+func sameHemisphere(points []model.Point) bool {
+	for _, p := range points[1:] {
+		if (p.Lat < 0) != (points[0].Lat < 0) || (p.Lon < 0) != (points[0].Lon < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Coordinates are unsigned, so the hemisphere is set in the attributes based on the first point
+func regionAttributes(r model.Region) uint16 {
+	var attr uint16
+	if r.MaxSpeed != nil {
+		attr |= regionAttrSpeedLimit
+	}
+	if r.AlarmOnEnter {
+		attr |= regionAttrAlarmOnEnter
+	}
+	if r.AlarmOnExit {
+		attr |= regionAttrAlarmOnExit
+	}
+	if r.Points[0].Lat < 0 {
+		attr |= regionAttrSouthLatitude
+	}
+	if r.Points[0].Lon < 0 {
+		attr |= regionAttrWestLongitude
+	}
+	return attr
+}
+
+func sectionAttributes(r model.Region, p model.Point) uint8 {
+	var attr uint8
+	if r.MaxSpeed != nil {
+		attr |= sectionAttrSpeedLimit
+	}
+	if p.Lat < 0 {
+		attr |= sectionAttrSouthLatitude
+	}
+	if p.Lon < 0 {
+		attr |= sectionAttrWestLongitude
+	}
+	return attr
+}
+
+// Write lat(4) and lon(4) in millionths of a degree
+func writeRegionPoint(buf *bytes.Buffer, p model.Point) {
+	lat := utils.FromStdCoordinate(p.Lat, CoordinatePrecision)
+	lon := utils.FromStdCoordinate(p.Lon, CoordinatePrecision)
+	binary.Write(buf, binary.BigEndian, uint32(max(lat, -lat)))
+	binary.Write(buf, binary.BigEndian, uint32(max(lon, -lon)))
+}
+
+// Write max speed(2) and overspeed duration(1) if the region has a speed limit
+func writeSpeedLimit(buf *bytes.Buffer, r model.Region) {
+	if r.MaxSpeed == nil {
+		return
+	}
+	binary.Write(buf, binary.BigEndian, *r.MaxSpeed)
+	buf.WriteByte(r.OverspeedDuration)
+}
+
+// Write night max speed(2) for JT808-2019 if the region has a speed limit, which is set to the same speed
+func writeNightSpeedLimit(buf *bytes.Buffer, r model.Region, version uint8) {
+	if r.MaxSpeed == nil || version == Version2013 {
+		return
+	}
+	binary.Write(buf, binary.BigEndian, *r.MaxSpeed)
+}
+
+// Write name length(2) and GBK encoded name
+func writeRegionName(buf *bytes.Buffer, name string) {
+	encoded, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(name))
+	if err != nil {
+		encoded = []byte(name)
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(encoded)))
+	buf.Write(encoded)
+}
@@ -0,0 +1,60 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"banjo.dev/trackerr/internal/model"
+)
+
+// Registration response results
+const (
+	RegistrationSuccess           uint8 = 0
+	RegistrationVehicleRegistered uint8 = 1
+	RegistrationNoSuchVehicle     uint8 = 2
+	RegistrationTermRegistered    uint8 = 3
+	RegistrationNoSuchTerminal    uint8 = 4
+)
+
+// Reject registrations where the reported terminal model does not match the model of the tracker
+var VerifyModel bool
+
+// Parse terminal registration message
+// JT808-2013 body is province(2), city(2), manufacturer(5), model(20), terminal id(7), plate colour(1), plate number(rest)
+// JT808-2019 extends manufacturer to 11 bytes, model to 30 bytes and terminal id to 30 bytes
+func ParseRegistrationMsg(payload []byte, version uint8) (model.Registration, error) {
+	manufacturerLen, modelLen, terminalIdLen := 5, 20, 7
+	if version != Version2013 {
+		manufacturerLen, modelLen, terminalIdLen = 11, 30, 30
+	}
+	var r model.Registration
+	fixedLen := 4 + manufacturerLen + modelLen + terminalIdLen + 1
+	if len(payload) < fixedLen {
+		return r, fmt.Errorf("registration payload too short: %v bytes", len(payload))
+	}
+	r.ProvinceId = binary.BigEndian.Uint16(payload[0:2])
+	r.CityId = binary.BigEndian.Uint16(payload[2:4])
+	offset := 4
+	r.ManufacturerId = parseRegistrationString(payload[offset : offset+manufacturerLen])
+	offset += manufacturerLen
+	r.TerminalModel = parseRegistrationString(payload[offset : offset+modelLen])
+	offset += modelLen
+	r.TerminalId = parseRegistrationString(payload[offset : offset+terminalIdLen])
+	offset += terminalIdLen
+	r.PlateColour = payload[offset]
+	// Plate number is GBK encoded
+	r.PlateNumber = decodeGBK(payload[offset+1:])
+	return r, nil
+}
+
+// Check if the terminal model reported in registration matches the model of the tracker
+func ModelMatches(r model.Registration, trackerModel string) bool {
+	return strings.EqualFold(r.TerminalModel, trackerModel)
+}
+
+// Fixed length strings are padded with 0x00 or spaces
+func parseRegistrationString(b []byte) string {
+	return strings.TrimSpace(string(bytes.Trim(b, "\x00")))
+}
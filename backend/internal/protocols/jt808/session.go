@@ -0,0 +1,407 @@
+package jt808
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"banjo.dev/trackerr/internal/database"
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// JT808 protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeJT808
+}
+
+func (Protocol) Name() string {
+	return "JT808"
+}
+
+func (Protocol) Detect(start byte) bool {
+	return start == StartByte
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	return ParseMsg(conn, utils.NullTime{IsSet: false})
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	return PerformAuth(conn, p)
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	s := &Session{
+		t:                t,
+		resultChannelMap: make(map[uint16]resultChannel),
+		reassembler:      NewReassembler(),
+	}
+	if ld, err := database.GetLocation(t.Id); err == nil {
+		s.lastAlarmFlags = ld.AlarmFlags
+	}
+	if trip, err := database.GetOpenTrip(t.Id); err == nil {
+		s.driverId = &trip.DriverId
+	}
+	return s
+}
+
+// Serial number acknowledging all alarms of a type, used for alarms not raised by a position report
+const allAlarmsSerial uint16 = 0
+
+// Positions with a GPS time within this age are live fixes
+const liveFixAge time.Duration = time.Minute
+
+// Time to wait for the response to a sent message, after which its result channel is removed
+// Matches the time the API waits, so serial numbers reused after wrapping do not resolve old channels
+const resultTimeout time.Duration = 30 * time.Second
+
+// Result channel of a sent message, which is removed at its deadline
+type resultChannel struct {
+	channel  chan model.CommandResult
+	deadline time.Time
+}
+
+// Connection to a JT808 terminal
+type Session struct {
+	t *model.TrackerHandler
+	// Result channels of sent messages, mapped by the serial number the tracker will reply to
+	resultChannelMap map[uint16]resultChannel
+	// Sub-packaged messages are buffered until all packages are received
+	reassembler *Reassembler
+	// Message sent as sub-packages, with the channels of the command it was sent for
+	sender         *SubPackageSender
+	senderResult   chan model.CommandResult
+	senderProgress chan int
+	senderUpdated  time.Time
+	// Alarm flags of the last position report, so alarms are only stored when raised
+	lastAlarmFlags uint32
+	// Driver currently logged in, who is linked to reported positions
+	driverId *int
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	t := s.t
+	SendCmd(t.Conn, command, t.Id, t.SerialNumber, t.ProtocolVersion)
+	t.SerialNumber++
+	// Command responses do not refer to the command, so they are matched in order
+	return 0, nil
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	t := s.t
+	if len(cmd.Body) > MaxSubPackageLength {
+		if s.sender != nil {
+			return ErrSubPackageBusy
+		}
+		// Sub-packages are sent one at a time, when the previous one is acknowledged
+		s.sender = NewSubPackageSender(cmd.MsgType, cmd.Body, t.SerialNumber)
+		s.senderResult = cmd.Result
+		s.senderProgress = cmd.Progress
+		t.SerialNumber += uint16(s.sender.Count())
+		s.sender.SendNext(t.Conn, t.Id, t.ProtocolVersion)
+		s.senderUpdated = time.Now()
+		log.Printf("%v: Sending message %#04x as %v packages\n", t.Id, cmd.MsgType, s.sender.Count())
+		return nil
+	}
+	SendMsg(t.Conn, cmd.MsgType, cmd.Body, t.SerialNumber, t.Id, t.ProtocolVersion)
+	s.resultChannelMap[t.SerialNumber] = resultChannel{channel: cmd.Result, deadline: time.Now().Add(resultTimeout)}
+	t.SerialNumber++
+	log.Printf("%v: Sent message: %#04x\n", t.Id, cmd.MsgType)
+	return nil
+}
+
+func (s *Session) Tick(now time.Time) {
+	t := s.t
+	// Remove result channels of messages which were not answered in time
+	for serial, r := range s.resultChannelMap {
+		if now.After(r.deadline) {
+			delete(s.resultChannelMap, serial)
+		}
+	}
+	// Request missing packages of incomplete sub-packaged messages
+	for _, req := range s.reassembler.Expired(now) {
+		log.Printf("%v: Requesting retransmission of packages %v\n", t.Id, req.Missing)
+		SendMsg(t.Conn, MsgTypeRetransmissionReq, EncodeRetransmissionRequest(req, t.ProtocolVersion), t.SerialNumber, t.Id, t.ProtocolVersion)
+		t.SerialNumber++
+	}
+	// Abort sub-packaged message if the tracker stopped acknowledging packages
+	if s.sender != nil && now.Sub(s.senderUpdated) > SubPackageTimeout {
+		log.Printf("%v: Aborting message %#04x after %v of %v packages\n", t.Id, s.sender.MsgType, s.sender.Sent(), s.sender.Count())
+		s.senderResult <- model.CommandResult{Err: fmt.Errorf("package %v was not acknowledged", s.sender.Sent())}
+		s.sender = nil
+	}
+}
+
+// Send response packet to the result channel of the message it replies to
+func (s *Session) deliverResult(p model.Packet) {
+	replySerial, err := ParseReplySerial(p.Payload)
+	if err != nil {
+		log.Printf("%v: %v\n", s.t.Id, err)
+		return
+	}
+	// Find corresponding result channel in map
+	rChannel, ok := s.resultChannelMap[replySerial]
+	if !ok {
+		return
+	}
+	rChannel.channel <- model.CommandResult{Packet: p}
+	delete(s.resultChannelMap, replySerial)
+}
+
+// Send next sub-package if p acknowledges the last one sent
+// Returns false if p is not an acknowledgement of a sub-package
+func (s *Session) handleSubPackageAck(p model.Packet) bool {
+	if s.sender == nil {
+		return false
+	}
+	replySerial, _, result, err := ParseUniversalRes(p.Payload)
+	if err != nil || !s.sender.IsAck(replySerial) {
+		return false
+	}
+	// Stop sending if the tracker did not accept the sub-package
+	if result != ResultSuccess || s.sender.Done() {
+		s.senderResult <- model.CommandResult{Packet: p}
+		s.sender = nil
+		return true
+	}
+	if s.senderProgress != nil {
+		select {
+		case s.senderProgress <- s.sender.Sent():
+		default:
+		}
+	}
+	s.sender.SendNext(s.t.Conn, s.t.Id, s.t.ProtocolVersion)
+	s.senderUpdated = time.Now()
+	return true
+}
+
+// Convert position to standard precision and link it to the driver logged in at the time of the position
+// Live positions without a matching trip, such as those reported right before the card login is stored,
+// are linked to the driver currently logged in
+func (s *Session) locationEvent(ld model.Locationdata) protocols.Event {
+	utils.StdLatLon(&ld, CoordinatePrecision)
+	if trip, err := database.GetTripAt(s.t.Id, ld.Timestamp); err == nil {
+		ld.DriverId = &trip.DriverId
+	} else if !ld.Historic && time.Since(time.Unix(ld.Timestamp, 0)) < liveFixAge {
+		ld.DriverId = s.driverId
+	}
+	return protocols.Event{Location: &ld}
+}
+
+// Get alarm events of the alarms raised in ld since previous flags
+// Alarms are stored with the serial number of the position report, which is used to acknowledge them.
+// Alarms of other messages use serial number 0, which acknowledges all alarms of the type
+func alarmEvents(ld model.Locationdata, previous uint32, serialNumber uint16) []protocols.Event {
+	var events []protocols.Event
+	for _, alarm := range ParseAlarms(ld, previous) {
+		alarm.SerialNumber = &serialNumber
+		events = append(events, protocols.Event{Alarm: &alarm})
+	}
+	return events
+}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	// Reply using the protocol version the terminal currently uses
+	if p.Version != t.ProtocolVersion {
+		log.Printf("%v: Protocol version changed from %v to %v\n", t.Id, t.ProtocolVersion, p.Version)
+		t.ProtocolVersion = p.Version
+	}
+	// Handle sub-packaged messages once all packages are received
+	if p.PackageCount > 1 {
+		complete, ok := s.reassembler.Add(p)
+		if !ok {
+			return nil, nil
+		}
+		log.Printf("%v: Reassembled message %#04x from %v packages\n", t.Id, p.PacketType, p.PackageCount)
+		p = complete
+	}
+	switch p.PacketType {
+
+	case MsgTypeTermUniversalRes, MsgTypeQueryParamsRes, MsgTypeSnapshotRes: // Responses to sent messages
+		if p.PacketType == MsgTypeTermUniversalRes && s.handleSubPackageAck(p) {
+			return nil, nil
+		}
+		s.deliverResult(p)
+	case MsgTypeUpgradeResult: // Firmware upgrade result
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		upgradeType, result, err := ParseUpgradeResult(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse upgrade result: %v", err)
+		}
+		log.Printf("%v: Firmware upgrade of type %v finished with result %v\n", t.Id, upgradeType, result)
+		status := model.FirmwareUpgradeFailed
+		switch result {
+		case UpgradeSuccess:
+			status = model.FirmwareUpgradeSucceeded
+		case UpgradeCancelled:
+			status = model.FirmwareUpgradeCancelled
+		}
+		if err := database.FinishFirmwareUpgrade(t.Id, status, time.Now().Unix()); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	case MsgTypeQueryLocationRes: // Position query response
+		s.deliverResult(p)
+		ld, err := ParseQueryLocationRes(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse position: %v", err)
+		}
+		event := s.locationEvent(ld)
+		events := alarmEvents(*event.Location, s.lastAlarmFlags, allAlarmsSerial)
+		s.lastAlarmFlags = ld.AlarmFlags
+		return append(events, event), nil
+	case MsgTypeHeartbeat: // Heartbeat
+		log.Println("Recevied heartbeat")
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		return []protocols.Event{{Heartbeat: true}}, nil
+	case MsgTypeLogout: // log out
+		if err := database.RemoveAuthCode(t.Id); err != nil {
+			log.Println(err)
+		}
+		return nil, protocols.ErrLoggedOut
+	case MsgTypeLocation: // Position info report
+		log.Println("Recevied position info")
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		ld, err := ParseLocationMsg(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse position: %v", err)
+		}
+		event := s.locationEvent(ld)
+		events := alarmEvents(*event.Location, s.lastAlarmFlags, p.SerialNumber)
+		s.lastAlarmFlags = ld.AlarmFlags
+		return append(events, event), nil
+	case MsgTypeVersionInfo: // Version info packet
+		log.Println("Recevied version info")
+		payload := append(GetCNTimeAsBCD(), []byte{0, 0, 0, 0, 0}...)
+		log.Println("Chinese time:", payload)
+		SendMsg(t.Conn, MsgTypeVersionInfoRes, payload, p.SerialNumber, t.Id, t.ProtocolVersion)
+	case MsgTypeLocationBatch: // Position info batch report
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		lds, err := ParseLocationBatchMsg(p.Payload)
+		log.Printf("%v: Received %v buffered positions\n", t.Id, len(lds))
+		// Store the records which were parsed, even if the batch was incomplete
+		// Alarms are raised by flags not set in the previous record. Records uploaded from blind areas
+		// are older than the last position report, so they do not change the flags of the session
+		var events []protocols.Event
+		previous := s.lastAlarmFlags
+		for _, ld := range lds {
+			event := s.locationEvent(ld)
+			events = append(events, alarmEvents(*event.Location, previous, allAlarmsSerial)...)
+			events = append(events, event)
+			previous = ld.AlarmFlags
+		}
+		if len(lds) > 0 && !lds[0].Historic {
+			s.lastAlarmFlags = previous
+		}
+		if err != nil {
+			return events, fmt.Errorf("failed to parse batch: %v", err)
+		}
+		return events, nil
+	case MsgTypeMediaEvent: // Multimedia event
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		m, err := ParseMediaEvent(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse multimedia event: %v", err)
+		}
+		log.Printf("%v: Multimedia %v of type %v captured on channel %v\n", t.Id, m.MediaId, m.Type, m.Channel)
+	case MsgTypeMediaUpload: // Multimedia data upload, reassembled from sub-packages
+		m, ld, data, err := ParseMediaUpload(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse multimedia upload: %v", err)
+		}
+		// Acknowledge the complete upload
+		SendMsg(t.Conn, MsgTypeMediaUploadRes, EncodeMediaUploadRes(m.MediaId, nil), t.SerialNumber, t.Id, t.ProtocolVersion)
+		t.SerialNumber++
+		event := s.locationEvent(ld)
+		m.TrackerId = t.Id
+		m.ReceivedAt = time.Now().Unix()
+		m.Timestamp = ld.Timestamp
+		if m.Timestamp == 0 {
+			m.Timestamp = m.ReceivedAt
+		}
+		m.Lat = event.Location.Lat
+		m.Lon = event.Location.Lon
+		m.AlarmFlags = ld.AlarmFlags
+		m, err = database.SaveMedia(m, data, MediaExtension(m.Format))
+		if err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+			return nil, nil
+		}
+		log.Printf("%v: Stored multimedia %v of %v bytes at %v\n", t.Id, m.MediaId, m.Size, m.Path)
+		return []protocols.Event{event}, nil
+	case MsgTypeDriverIdentity: // Driver IC card inserted or removed
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		d, err := ParseDriverIdentity(p.Payload, p.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse driver identity: %v", err)
+		}
+		s.handleDriverIdentity(d)
+	case MsgTypeUpstreamData: // Upstream passthrough data
+		SendUniversalRes(t.Conn, p.PacketType, p.SerialNumber, ResultSuccess, t.Id, t.ProtocolVersion)
+		passthroughType, data, err := ParsePassthrough(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse passthrough data: %v", err)
+		}
+		log.Printf("%v: Received %v bytes of %v passthrough data\n", t.Id, len(data), PassthroughTypeName(passthroughType))
+		d := model.PassthroughData{TrackerId: t.Id, Timestamp: time.Now().Unix(), Type: passthroughType, Data: data}
+		if err := database.InsertPassthroughData(d); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+	case MsgTypeCmdRes: // Command Response
+		r := ParseCmdRes(p.Payload)
+		return []protocols.Event{{CmdResponse: &protocols.CmdResponse{Text: r}}}, nil
+	default:
+		log.Printf("%v: Unknown protocol number: %x\nPayload:%v", t.Id, p.PacketType, p.Payload)
+	}
+	return nil, nil
+}
+
+// Start trip of driver when an IC card is inserted, and end it when removed
+func (s *Session) handleDriverIdentity(d DriverIdentity) {
+	t := s.t
+	if d.Timestamp == 0 {
+		d.Timestamp = time.Now().Unix()
+	}
+	if d.Status != DriverCardInserted {
+		log.Printf("%v: Driver logged out\n", t.Id)
+		s.driverId = nil
+		if err := database.EndTrips(t.Id, d.Timestamp); err != nil {
+			log.Printf("%v: Error: %v\n", t.Id, err)
+		}
+		return
+	}
+	if d.ReadResult != CardReadSuccess {
+		log.Printf("%v: Failed to read driver IC card, result %v\n", t.Id, d.ReadResult)
+		return
+	}
+	log.Printf("%v: Driver %v logged in\n", t.Id, d.Name)
+	id, err := database.SaveDriver(model.Driver{
+		Name:              d.Name,
+		Certificate:       d.Certificate,
+		Agency:            d.Agency,
+		CertificateExpiry: d.CertificateExpiry,
+		IdNumber:          d.IdNumber,
+		LastSeen:          d.Timestamp,
+	})
+	if err != nil {
+		log.Printf("%v: Error: %v\n", t.Id, err)
+		return
+	}
+	s.driverId = &id
+	if err := database.StartTrip(id, t.Id, d.Timestamp); err != nil {
+		log.Printf("%v: Error: %v\n", t.Id, err)
+	}
+}
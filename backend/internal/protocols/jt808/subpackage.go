@@ -0,0 +1,212 @@
+package jt808
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+)
+
+const (
+	// Time to wait for the next sub-package before requesting missing ones
+	SubPackageTimeout time.Duration = 10 * time.Second
+	// Number of retransmission requests sent before an incomplete message is discarded
+	SubPackageMaxRetries int = 3
+)
+
+// Sub-packages received of a message
+type packageSet struct {
+	first       model.Packet
+	firstSerial uint16
+	count       uint16
+	parts       map[uint16][]byte
+	updated     time.Time
+	retries     int
+}
+
+// Request for retransmission of missing sub-packages
+type RetransmissionRequest struct {
+	FirstSerial uint16
+	Missing     []uint16
+}
+
+// Reassembles sub-packaged messages of a single session, keyed by the serial number of their first sub-package
+type Reassembler struct {
+	sets map[uint16]*packageSet
+}
+
+func NewReassembler() *Reassembler {
+	return &Reassembler{sets: make(map[uint16]*packageSet)}
+}
+
+// Add sub-package p. When all sub-packages of the message have been received, the
+// reassembled packet is returned with the serial number of the first sub-package
+func (r *Reassembler) Add(p model.Packet) (model.Packet, bool) {
+	if p.PackageIndex < 1 || p.PackageIndex > p.PackageCount {
+		log.Printf("%v: Invalid sub-package %v of %v\n", p.DeviceID, p.PackageIndex, p.PackageCount)
+		return p, false
+	}
+	// Sub-packages of a message have consecutive serial numbers
+	firstSerial := p.SerialNumber - (p.PackageIndex - 1)
+	set, ok := r.sets[firstSerial]
+	if !ok || set.first.PacketType != p.PacketType || set.count != p.PackageCount {
+		set, ok = r.resentSet(p)
+	}
+	// Start new set, which replaces older incomplete sets of the same message id
+	if !ok {
+		for serial, old := range r.sets {
+			if old.first.PacketType == p.PacketType {
+				delete(r.sets, serial)
+			}
+		}
+		set = &packageSet{
+			first:       p,
+			firstSerial: firstSerial,
+			count:       p.PackageCount,
+			parts:       make(map[uint16][]byte),
+		}
+		r.sets[firstSerial] = set
+	}
+	set.parts[p.PackageIndex] = p.Payload
+	set.updated = time.Now()
+	if len(set.parts) < int(set.count) {
+		return p, false
+	}
+
+	// Concatenate payloads in order
+	// PayloadLength is left as the length of the first sub-package, since reassembled bodies may exceed it
+	delete(r.sets, set.firstSerial)
+	payload := bytes.NewBuffer([]byte{})
+	for i := uint16(1); i <= set.count; i++ {
+		payload.Write(set.parts[i])
+	}
+	complete := set.first
+	complete.Payload = payload.Bytes()
+	complete.SerialNumber = set.firstSerial
+	complete.PackageCount = 0
+	complete.PackageIndex = 0
+	return complete, true
+}
+
+// Get set which sub-package p was resent for
+// Resent sub-packages may have new serial numbers, so they are matched by message id and package count
+// to a set which retransmission was requested for, and which is missing the sub-package
+func (r *Reassembler) resentSet(p model.Packet) (*packageSet, bool) {
+	for _, set := range r.sets {
+		if set.retries == 0 || set.first.PacketType != p.PacketType || set.count != p.PackageCount {
+			continue
+		}
+		if _, ok := set.parts[p.PackageIndex]; !ok {
+			return set, true
+		}
+	}
+	return nil, false
+}
+
+// Get retransmission requests for messages which have not received a sub-package within SubPackageTimeout
+// Messages which have reached SubPackageMaxRetries are discarded
+func (r *Reassembler) Expired(now time.Time) []RetransmissionRequest {
+	var requests []RetransmissionRequest
+	for serial, set := range r.sets {
+		if now.Sub(set.updated) < SubPackageTimeout {
+			continue
+		}
+		if set.retries >= SubPackageMaxRetries {
+			log.Printf("%v: Discarding incomplete message %#04x with %v of %v sub-packages\n", set.first.DeviceID, set.first.PacketType, len(set.parts), set.count)
+			delete(r.sets, serial)
+			continue
+		}
+		var missing []uint16
+		for i := uint16(1); i <= set.count; i++ {
+			if _, ok := set.parts[i]; !ok {
+				missing = append(missing, i)
+			}
+		}
+		set.retries++
+		set.updated = now
+		requests = append(requests, RetransmissionRequest{FirstSerial: set.firstSerial, Missing: missing})
+	}
+	return requests
+}
+
+// Encode retransmission request message body
+// Body is first serial(2), count, followed by sub-package indexes(2 each)
+// Count is 1 byte in JT808-2013 and 2 bytes in JT808-2019
+func EncodeRetransmissionRequest(req RetransmissionRequest, version uint8) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	binary.Write(buf, binary.BigEndian, req.FirstSerial)
+	if version == Version2013 {
+		buf.WriteByte(byte(len(req.Missing)))
+	} else {
+		binary.Write(buf, binary.BigEndian, uint16(len(req.Missing)))
+	}
+	for _, index := range req.Missing {
+		binary.Write(buf, binary.BigEndian, index)
+	}
+	return buf.Bytes()
+}
+
+// Maximum body length of sub-packages sent to terminals
+const MaxSubPackageLength int = 1000
+
+// Returned when a sub-packaged message is sent while another one is still being sent
+var ErrSubPackageBusy = errors.New("another sub-packaged message is being sent")
+
+// Sends a message split into sub-packages, one at a time. The next sub-package is sent
+// when the terminal has acknowledged the previous one
+type SubPackageSender struct {
+	MsgType     uint16
+	parts       [][]byte
+	firstSerial uint16
+	sent        int
+}
+
+// Split body into sub-packages, which are sent with consecutive serial numbers starting at firstSerial
+func NewSubPackageSender(msgType uint16, body []byte, firstSerial uint16) *SubPackageSender {
+	s := &SubPackageSender{MsgType: msgType, firstSerial: firstSerial}
+	for len(body) > MaxSubPackageLength {
+		s.parts = append(s.parts, body[:MaxSubPackageLength])
+		body = body[MaxSubPackageLength:]
+	}
+	s.parts = append(s.parts, body)
+	return s
+}
+
+// Get number of sub-packages body is split into
+func SubPackageCount(body []byte) int {
+	return max(1, (len(body)+MaxSubPackageLength-1)/MaxSubPackageLength)
+}
+
+// Get total number of sub-packages
+func (s *SubPackageSender) Count() int {
+	return len(s.parts)
+}
+
+// Get number of sub-packages sent
+func (s *SubPackageSender) Sent() int {
+	return s.sent
+}
+
+// Check if all sub-packages have been sent
+func (s *SubPackageSender) Done() bool {
+	return s.sent == len(s.parts)
+}
+
+// Check if replySerial acknowledges the last sent sub-package
+func (s *SubPackageSender) IsAck(replySerial uint16) bool {
+	return s.sent > 0 && replySerial == s.firstSerial+uint16(s.sent-1)
+}
+
+// Send next sub-package
+func (s *SubPackageSender) SendNext(conn net.Conn, trackerID string, version uint8) {
+	if s.Done() {
+		return
+	}
+	serial := s.firstSerial + uint16(s.sent)
+	sendMsg(conn, s.MsgType, s.parts[s.sent], serial, trackerID, version, uint16(len(s.parts)), uint16(s.sent+1))
+	s.sent++
+}
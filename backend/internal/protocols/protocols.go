@@ -1,66 +1,112 @@
 package protocols
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"time"
 
 	"banjo.dev/trackerr/internal/model"
-	"banjo.dev/trackerr/internal/protocols/gt06"
-	"banjo.dev/trackerr/internal/protocols/jt808"
-	"banjo.dev/trackerr/internal/utils"
 )
 
+// Protocol spoken by a family of trackers. Protocols register themselves with Register,
+// and the server detects the protocol of a connection from the first byte it receives
+type Protocol interface {
+	// Protocol type stored in TrackerHandler.Protocol
+	Type() int
+	Name() string
+	// Check if start is the first byte of a message of the protocol
+	Detect(start byte) bool
+	// Read the rest of the message starting with start from conn
+	ReadFrame(conn net.Conn, start byte) (model.Packet, error)
+	// Authenticate tracker after receiving first message p
+	// Returns tracker id and the protocol version used by the tracker
+	PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error)
+	// Time in which trackers send at least one heartbeat
+	HeartbeatInterval() time.Duration
+	// Create session for the connection of an authenticated tracker
+	NewSession(t *model.TrackerHandler) Session
+}
+
+// Implemented by protocols without a login message, which identify trackers from any message they send
+type Loginless interface {
+	Protocol
+	// Check if the first message p, used to authenticate the tracker, should also be decoded by the session
+	DecodeFirst(p model.Packet) bool
+}
+
+// State of the connection to a tracker
+type Session interface {
+	// Decode message p into events, replying to the tracker if required by the protocol
+	Decode(p model.Packet) ([]Event, error)
+	// Send text command, and return the id its response is matched with
+	SendCommand(command string) (uint32, error)
+	// Send protocol specific message of cmd. The result is sent to cmd.Result
+	SendMessage(cmd model.TrackerCommand) error
+	// Called every second, to retransmit or time out messages
+	Tick(now time.Time)
+}
+
+// Event decoded from a message. Only the fields reported by the message are set
+// Locations use the standard coordinate precision, and the tracker id and receive time are set by the server
+type Event struct {
+	Location    *model.Locationdata
+	Status      *model.TerminalStatus
+	Alarm       *model.Alarm
+	IMSI        string
+	ICCID       string
+	Heartbeat   bool
+	CmdResponse *CmdResponse
+}
+
+// Response to a text command. If HasId is not set, the response is for the oldest command waiting for a response
+type CmdResponse struct {
+	Id    uint32
+	HasId bool
+	Text  string
+}
+
+// Returned by Session.Decode when the tracker logs out, to close the connection
+var ErrLoggedOut = errors.New("tracker logged out")
+
+// Time to wait for the rest of a message after its start byte is received
+const frameTimeout = 10 * time.Second
+
+var registry []Protocol
+
+// Add protocol p to the protocols detected by the server
+func Register(p Protocol) {
+	registry = append(registry, p)
+}
+
 // Detect protocol and authenticate accordingly
-func PerformAuth(conn net.Conn) (string, int, error) {
+// Returns tracker id, protocol, the protocol version used by the tracker and the first message
+func PerformAuth(conn net.Conn) (string, Protocol, uint8, model.Packet, error) {
 	p, protocol, err := ParseMsg(conn, 60*time.Second)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to parse: %v", err)
+		return "", nil, 0, p, fmt.Errorf("failed to parse: %v", err)
 	}
-	switch protocol {
-	case utils.ProtocolTypeJT808:
-		id, err := jt808.PerformAuth(conn, p)
-		return id, protocol, err
-	case utils.ProtocolTypeGT06:
-		id, err := gt06.PerformAuth(conn, p)
-		return id, protocol, err
-	}
-	return "", 0, fmt.Errorf("unknown protocol")
+	id, version, err := protocol.PerformAuth(conn, p)
+	return id, protocol, version, p, err
 }
 
-// Read start byte/bytes and pass to corresponding parser
-func ParseMsg(conn net.Conn, maxWait time.Duration) (model.Packet, int, error) {
+// Read start byte and pass to the parser of the protocol detecting it
+func ParseMsg(conn net.Conn, maxWait time.Duration) (model.Packet, Protocol, error) {
 	// Set deadline to make more and less blocking
 	// The deadline is high when waiting for login and low for other cases to allow goroutine to read command channel
 	conn.SetReadDeadline(time.Now().Add(maxWait))
 	start := make([]byte, 1)
 	_, err := conn.Read(start)
 	if err != nil {
-		return model.Packet{}, 0, err
+		return model.Packet{}, nil, err
 	}
-
-	switch start[0] {
-	case jt808.StartByte: // Start byte used for JT808
-		p, err := jt808.ParseMsg(conn, utils.NullTime{IsSet: false})
-		return p, utils.ProtocolTypeJT808, err
-	case gt06.StartByte, gt06.StartByteExtended: //Start bytes used for GT06
-
-		// Verify that also the second byte is valid
-		start2 := make([]byte, 1)
-		conn.SetReadDeadline(time.Now().Add(maxWait * time.Second))
-		_, err := conn.Read(start2)
-		if err != nil {
-			return model.Packet{}, 0, err
+	// Allow the rest of the message to arrive
+	conn.SetReadDeadline(time.Now().Add(frameTimeout))
+	for _, protocol := range registry {
+		if protocol.Detect(start[0]) {
+			p, err := protocol.ReadFrame(conn, start[0])
+			return p, protocol, err
 		}
-		if start[0] != start2[0] {
-			log.Printf("invalid secondary byte: %v %v\n", start[0], start2[0])
-			return model.Packet{}, utils.ProtocolTypeJT808, fmt.Errorf("invalid second start byte")
-		}
-
-		p, err := gt06.ParseMsg(conn, start[0] == gt06.StartByteExtended)
-		return p, utils.ProtocolTypeGT06, err
-	default:
-		return model.Packet{}, 0, fmt.Errorf("invalid start bytes: %v byte was:%v", err, start[0])
 	}
+	return model.Packet{}, nil, fmt.Errorf("invalid start byte: %#02x", start[0])
 }
@@ -0,0 +1,271 @@
+package queclink
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Constants specific to Queclink @Track
+const (
+	StartByte           byte    = '+'
+	EndByte             byte    = '$'
+	coordinatePrecision float64 = 1000000
+	KindReport          string  = "RESP"
+	KindBuffered        string  = "BUFF"
+	KindAck             string  = "ACK"
+	MsgTypeFixedReport  string  = "GTFRI"
+	MsgTypeSOS          string  = "GTSOS"
+	MsgTypeIgnitionOn   string  = "GTIGN"
+	MsgTypeIgnitionOff  string  = "GTIGF"
+	MsgTypePowerOn      string  = "GTPNA"
+	MsgTypeHeartbeat    string  = "GTHBD"
+	// Position blocks are GPS accuracy, speed, azimuth, altitude, lon, lat, GPS time, mcc, mnc, lac, cell id and a reserved field
+	positionBlockLength int = 12
+	// Reports end with the send time and count number
+	reportTrailerLength int = 2
+	// Longest message accepted, to limit the buffer used while waiting for the end byte
+	maxLength int = 2048
+	// Trackers send heartbeats at least every hour, when they have no reports to send
+	HeartbeatInterval time.Duration = time.Hour
+)
+
+// Names of alarm types
+var alarmTypes = map[uint16]string{
+	0: "SOS",
+}
+
+// Alarm types of reports
+var reportAlarms = map[string]uint16{
+	MsgTypeSOS: 0,
+}
+
+// Offsets of the <Number> field of reports with a list of positions, in the order they are tried
+// GV models send the external power voltage before the report id, which moves the field by one
+var numberOffsets = map[string][]int{
+	MsgTypeFixedReport: {5, 6},
+	MsgTypeSOS:         {5, 6},
+}
+
+// Offsets of the position block of reports with a single position, which follows the device name and duration
+var positionOffsets = map[string]int{
+	MsgTypeIgnitionOn:  4,
+	MsgTypeIgnitionOff: 4,
+}
+
+// Report, buffered report or acknowledgement sent by a tracker
+// Fields are all fields following the message type, starting with the protocol version and IMEI,
+// and ending with the send time and count number
+type Message struct {
+	Kind   string
+	Type   string
+	Fields []string
+}
+
+// Perform Queclink authentication after receiving first message p
+// Trackers have no login message, so they are identified by the IMEI sent in every message
+func PerformAuth(p model.Packet) (string, error) {
+	if p.DeviceID == "" {
+		return "", fmt.Errorf("message does not contain an imei")
+	}
+	return p.DeviceID, nil
+}
+
+// Parse Queclink message, after the start byte has been read
+// Messages are +<kind>:<type>,<fields>$, and the payload is the message without the start and end byte
+func ParseMsg(conn io.Reader) (model.Packet, error) {
+	var p model.Packet
+	// Read one byte at a time, to not consume the following message
+	var text []byte
+	for {
+		b, err := utils.ReadBytes(conn, 1)
+		if err != nil {
+			return p, fmt.Errorf("failed to read message: %v", err)
+		}
+		if b[0] == EndByte {
+			break
+		}
+		if len(text) >= maxLength {
+			return p, fmt.Errorf("message exceeds %v bytes", maxLength)
+		}
+		text = append(text, b[0])
+	}
+	p.Payload = text
+	p.PayloadLength = uint16(len(text))
+	m, err := ParseMessage(text)
+	if err != nil {
+		return p, err
+	}
+	p.DeviceID = m.Fields[1]
+	return p, nil
+}
+
+// Split message payload into its kind, type and fields
+func ParseMessage(payload []byte) (Message, error) {
+	var m Message
+	kind, rest, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return m, fmt.Errorf("invalid message: %q", payload)
+	}
+	fields := strings.Split(rest, ",")
+	// Fields are at least the protocol version, IMEI, send time and count number
+	if len(fields) < 5 {
+		return m, fmt.Errorf("invalid message: %q", payload)
+	}
+	m.Kind = kind
+	m.Type = fields[0]
+	m.Fields = fields[1:]
+	return m, nil
+}
+
+// Get count number of message, which is used to acknowledge it
+func (m Message) Count() string {
+	return m.Fields[len(m.Fields)-1]
+}
+
+// Get time message m was sent as unix time, or the current time if it can not be parsed
+// The send time(YYYYMMDDHHMMSS) is the field before the count number
+func (m Message) SendTime() int64 {
+	t, err := time.Parse("20060102150405", m.Fields[len(m.Fields)-2])
+	if err != nil {
+		return time.Now().Unix()
+	}
+	return t.Unix()
+}
+
+// Get serial number of the command acknowledged by m
+// Acknowledgements end with the serial number, send time and count number
+func (m Message) Serial() (uint32, error) {
+	serial, err := strconv.ParseUint(m.Fields[len(m.Fields)-3], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid serial number: %v", err)
+	}
+	return uint32(serial), nil
+}
+
+// Parse positions of report, from the position blocks at the offset documented for its type
+// Positions without a GPS fix are skipped
+func ParsePositions(m Message) []model.Locationdata {
+	var blocks [][]string
+	if offset, ok := positionOffsets[m.Type]; ok && offset+positionBlockLength <= len(m.Fields)-reportTrailerLength {
+		blocks = append(blocks, m.Fields[offset:offset+positionBlockLength])
+	}
+	for _, offset := range numberOffsets[m.Type] {
+		if b, ok := positionBlocks(m.Fields, offset); ok {
+			blocks = b
+			break
+		}
+	}
+	var lds []model.Locationdata
+	for _, block := range blocks {
+		ld, ok := parsePosition(block)
+		if !ok {
+			continue
+		}
+		ld.Historic = m.Kind == KindBuffered
+		lds = append(lds, ld)
+	}
+	return lds
+}
+
+// Get position blocks following the <Number> field at offset
+// Returns false if the fields do not match this layout
+func positionBlocks(fields []string, offset int) ([][]string, bool) {
+	if offset >= len(fields) {
+		return nil, false
+	}
+	count, err := strconv.Atoi(fields[offset])
+	start := offset + 1
+	if err != nil || count < 1 || start+count*positionBlockLength > len(fields)-reportTrailerLength {
+		return nil, false
+	}
+	blocks := make([][]string, 0, count)
+	for i := 0; i < count; i++ {
+		block := fields[start+i*positionBlockLength : start+(i+1)*positionBlockLength]
+		// GPS time is empty or 14 digits
+		if block[6] != "" && len(block[6]) != 14 {
+			return nil, false
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, true
+}
+
+// Parse position block of fields GPS accuracy, speed, azimuth, altitude, lon, lat and GPS time(YYYYMMDDHHMMSS),
+// followed by cell information
+// Returns false if the tracker has no GPS fix, which is sent as accuracy 0 with the last known position
+func parsePosition(fields []string) (model.Locationdata, bool) {
+	var ld model.Locationdata
+	if fields[0] == "" || fields[0] == "0" || len(fields[6]) != 14 {
+		return ld, false
+	}
+	t, err := time.Parse("20060102150405", fields[6])
+	if err != nil {
+		return ld, false
+	}
+	lon, errLon := strconv.ParseFloat(fields[4], 64)
+	lat, errLat := strconv.ParseFloat(fields[5], 64)
+	if errLon != nil || errLat != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return ld, false
+	}
+	speed, _ := strconv.ParseFloat(fields[1], 64)
+	azimuth, _ := strconv.Atoi(fields[2])
+	altitude, _ := strconv.ParseFloat(fields[3], 64)
+	ld.Timestamp = t.Unix()
+	ld.Lat = int32(lat * coordinatePrecision)
+	ld.Lon = int32(lon * coordinatePrecision)
+	ld.Speed = uint16(speed)
+	ld.Heading = uint16(azimuth)
+	if altitude > 0 {
+		ld.Altitude = uint16(altitude)
+	}
+	utils.StdLatLon(&ld, coordinatePrecision)
+	return ld, true
+}
+
+// Get alarm of report m at position ld
+// Returns false if the report is not an alarm
+func ParseAlarm(m Message, ld model.Locationdata) (model.Alarm, bool) {
+	alarmType, ok := reportAlarms[m.Type]
+	if !ok {
+		return model.Alarm{}, false
+	}
+	return model.Alarm{
+		Timestamp: ld.Timestamp,
+		Type:      alarmType,
+		Name:      alarmTypes[alarmType],
+		Lat:       ld.Lat,
+		Lon:       ld.Lon,
+	}, true
+}
+
+// Encode heartbeat acknowledgement
+func EncodeHeartbeatAck(m Message) string {
+	return fmt.Sprintf("+SACK:%v,%v,%v%c", MsgTypeHeartbeat, m.Fields[0], m.Count(), EndByte)
+}
+
+// Encode AT command, replacing its last field with serial as 4 hex digits
+// Commands are AT+GT<command>=<password>,<parameters>,<serial number>$. The AT+ prefix and end byte are added if missing
+func EncodeCmd(command string, serial uint16) (string, error) {
+	command = strings.TrimSuffix(strings.TrimSpace(command), string(EndByte))
+	if !strings.HasPrefix(command, "AT+") {
+		command = "AT+" + command
+	}
+	fields := strings.Split(command, ",")
+	if len(fields) < 2 {
+		return "", fmt.Errorf("command must end with a serial number field")
+	}
+	fields[len(fields)-1] = fmt.Sprintf("%04X", serial)
+	return strings.Join(fields, ",") + string(EndByte), nil
+}
+
+// Send text message
+func SendMsg(conn net.Conn, msg string) {
+	conn.Write([]byte(msg))
+}
@@ -0,0 +1,135 @@
+package queclink
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Position blocks of the examples of the @Track protocol documentation
+const (
+	block1      = "1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00"
+	block2      = "2,0.0,0,65.2,-121.354300,-31.222100,20090214013324,0460,0000,18d8,6141,00"
+	blockNoFix  = "0,0.0,0,0.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00"
+	glTrailer   = ",2000.0,20090214093254,11F0$"
+	gvTrailer   = ",4.9,,,,100,210100,,,,20130312183936,00AA$"
+	imei        = "135790246811220"
+	glReportId  = "GTFRI,060100," + imei + ",,0,0,"
+	gvReportId  = "GTFRI,0F0106," + imei + ",,14827,10,1,"
+	position1At = "2009-02-14 01:32:54"
+	position2At = "2009-02-14 01:33:24"
+)
+
+// Parse frame, after the start byte as read by the protocol registry
+func readMessage(t *testing.T, frame string) Message {
+	t.Helper()
+	p, err := ParseMsg(bytes.NewReader([]byte(frame[1:])))
+	if err != nil {
+		t.Fatalf("ParseMsg: %v", err)
+	}
+	if p.DeviceID != imei {
+		t.Errorf("device id = %v, want %v", p.DeviceID, imei)
+	}
+	m, err := ParseMessage(p.Payload)
+	if err != nil {
+		t.Fatalf("ParseMessage: %v", err)
+	}
+	return m
+}
+
+// Check that coordinate c is deg degrees, within the precision of the standard coordinates
+func checkCoordinate(t *testing.T, name string, c int32, deg float64) {
+	t.Helper()
+	got := float64(utils.FromStdCoordinate(c, coordinatePrecision)) / coordinatePrecision
+	if diff := got - deg; diff > 0.00001 || diff < -0.00001 {
+		t.Errorf("%v = %v, want %v", name, got, deg)
+	}
+}
+
+func unix(s string) int64 {
+	t, _ := time.Parse(time.DateTime, s)
+	return t.Unix()
+}
+
+func TestParsePositions(t *testing.T) {
+	type position struct {
+		lat, lon  float64
+		speed     uint16
+		heading   uint16
+		timestamp int64
+	}
+	first := position{31.222073, 121.354335, 4, 92, unix(position1At)}
+	second := position{-31.2221, -121.3543, 0, 0, unix(position2At)}
+	tests := []struct {
+		name      string
+		frame     string
+		historic  bool
+		positions []position
+	}{
+		{"gl one position", "+RESP:" + glReportId + "1," + block1 + glTrailer, false, []position{first}},
+		{"gl two positions", "+RESP:" + glReportId + "2," + block1 + "," + block2 + glTrailer, false, []position{first, second}},
+		{"gv one position", "+RESP:" + gvReportId + "1," + block1 + gvTrailer, false, []position{first}},
+		{"gv two positions", "+RESP:" + gvReportId + "2," + block1 + "," + block2 + gvTrailer, false, []position{first, second}},
+		{"position without fix", "+RESP:" + glReportId + "2," + blockNoFix + "," + block2 + glTrailer, false, []position{second}},
+		{"buffered", "+BUFF:" + glReportId + "1," + block1 + glTrailer, true, []position{first}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := readMessage(t, tt.frame)
+			if m.Type != MsgTypeFixedReport {
+				t.Fatalf("type = %v, want %v", m.Type, MsgTypeFixedReport)
+			}
+			lds := ParsePositions(m)
+			if len(lds) != len(tt.positions) {
+				t.Fatalf("got %v positions, want %v", len(lds), len(tt.positions))
+			}
+			for i, want := range tt.positions {
+				ld := lds[i]
+				checkCoordinate(t, "lat", ld.Lat, want.lat)
+				checkCoordinate(t, "lon", ld.Lon, want.lon)
+				if ld.Speed != want.speed || ld.Heading != want.heading || ld.Timestamp != want.timestamp {
+					t.Errorf("position %v: got speed %v heading %v time %v", i, ld.Speed, ld.Heading, ld.Timestamp)
+				}
+				if ld.Historic != tt.historic {
+					t.Errorf("position %v: historic = %v, want %v", i, ld.Historic, tt.historic)
+				}
+			}
+		})
+	}
+}
+
+func TestAckSerial(t *testing.T) {
+	m := readMessage(t, "+ACK:GTRTO,060100,"+imei+",,GPS,0011,20090214093254,11F0$")
+	if m.Kind != KindAck {
+		t.Fatalf("kind = %v, want %v", m.Kind, KindAck)
+	}
+	serial, err := m.Serial()
+	if err != nil {
+		t.Fatalf("Serial: %v", err)
+	}
+	if serial != 0x11 {
+		t.Errorf("serial = %#x, want 0x11", serial)
+	}
+}
+
+func TestEncodeHeartbeatAck(t *testing.T) {
+	m := readMessage(t, "+ACK:GTHBD,060100,"+imei+",,20090214093254,11F0$")
+	if m.Kind != KindAck || m.Type != MsgTypeHeartbeat {
+		t.Fatalf("got kind %v type %v", m.Kind, m.Type)
+	}
+	if got, want := EncodeHeartbeatAck(m), "+SACK:GTHBD,060100,11F0$"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncodeCmd(t *testing.T) {
+	got, err := EncodeCmd("GTRTO=gl300,0,,,,,,FFFF", 0x11)
+	if err != nil {
+		t.Fatalf("EncodeCmd: %v", err)
+	}
+	if want := "AT+GTRTO=gl300,0,,,,,,0011$"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
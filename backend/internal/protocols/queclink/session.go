@@ -0,0 +1,140 @@
+package queclink
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Queclink protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeQueclink
+}
+
+func (Protocol) Name() string {
+	return "Queclink"
+}
+
+func (Protocol) Detect(start byte) bool {
+	return start == StartByte
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	return ParseMsg(conn)
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	id, err := PerformAuth(p)
+	return id, 0, err
+}
+
+// Every Queclink message is a report, so the first one is decoded as well
+func (Protocol) DecodeFirst(p model.Packet) bool {
+	return true
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	return &Session{t: t}
+}
+
+// Connection to a Queclink tracker
+type Session struct {
+	t *model.TrackerHandler
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	t := s.t
+	// The serial number of the command is included in its acknowledgement
+	cmd, err := EncodeCmd(command, t.SerialNumber)
+	if err != nil {
+		return 0, err
+	}
+	id := uint32(t.SerialNumber)
+	SendMsg(t.Conn, cmd)
+	t.SerialNumber++
+	return id, nil
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	return fmt.Errorf("message %#04x is not supported by Queclink", cmd.MsgType)
+}
+
+func (s *Session) Tick(now time.Time) {}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	m, err := ParseMessage(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+	events := []protocols.Event{{Heartbeat: true}}
+	// Heartbeats are sent as acknowledgements
+	if m.Kind == KindAck && m.Type == MsgTypeHeartbeat {
+		log.Printf("%v: Received heartbeat\n", t.Id)
+		SendMsg(t.Conn, EncodeHeartbeatAck(m))
+		return events, nil
+	}
+	// Acknowledgement of command
+	if m.Kind == KindAck {
+		serial, err := m.Serial()
+		if err != nil {
+			return events, fmt.Errorf("failed to parse acknowledgement: %v", err)
+		}
+		r := "+" + string(p.Payload) + string(EndByte)
+		return append(events, protocols.Event{CmdResponse: &protocols.CmdResponse{Id: serial, HasId: true, Text: r}}), nil
+	}
+	if m.Kind != KindReport && m.Kind != KindBuffered {
+		log.Printf("%v: Unknown message kind: %v\nPayload:%s", t.Id, m.Kind, p.Payload)
+		return events, nil
+	}
+	switch m.Type {
+	// Positions, which are alarms for SOS reports
+	case MsgTypeFixedReport, MsgTypeSOS:
+		lds := ParsePositions(m)
+		for _, ld := range lds {
+			if alarm, ok := ParseAlarm(m, ld); ok {
+				events = append(events, protocols.Event{Alarm: &alarm})
+			}
+			events = append(events, protocols.Event{Location: &ld})
+		}
+		// Alarms without a GPS fix are stored without position, at the time the report was sent
+		if len(lds) == 0 {
+			if alarm, ok := ParseAlarm(m, model.Locationdata{Timestamp: m.SendTime()}); ok {
+				events = append(events, protocols.Event{Alarm: &alarm})
+			}
+		}
+	// Ignition turned on or off
+	case MsgTypeIgnitionOn, MsgTypeIgnitionOff:
+		lds := ParsePositions(m)
+		ts := model.TerminalStatus{Timestamp: time.Now().Unix(), ACC: m.Type == MsgTypeIgnitionOn, GPSTracking: len(lds) > 0}
+		// Status of buffered reports is outdated
+		if m.Kind == KindReport {
+			events = append(events, protocols.Event{Status: &ts})
+		}
+		for i := range lds {
+			events = append(events, protocols.Event{Location: &lds[i]})
+		}
+	// Power on
+	case MsgTypePowerOn:
+		log.Printf("%v: Tracker powered on\n", t.Id)
+	default:
+		log.Printf("%v: Unknown report type: %v\nPayload:%s", t.Id, m.Type, strings.TrimSpace(string(p.Payload)))
+	}
+	return events, nil
+}
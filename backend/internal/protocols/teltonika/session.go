@@ -0,0 +1,110 @@
+package teltonika
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Teltonika protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeTeltonika
+}
+
+func (Protocol) Name() string {
+	return "Teltonika"
+}
+
+func (Protocol) Detect(start byte) bool {
+	return start == StartByte
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	return ParseMsg(conn)
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	id, err := PerformAuth(conn, p)
+	return id, 0, err
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	return &Session{t: t}
+}
+
+// Connection to a Teltonika tracker
+type Session struct {
+	t *model.TrackerHandler
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	SendCmd(s.t.Conn, command)
+	// Command responses do not refer to the command, so they are matched in order
+	return 0, nil
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	return fmt.Errorf("message %#04x is not supported by Teltonika", cmd.MsgType)
+}
+
+func (s *Session) Tick(now time.Time) {}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	switch uint8(p.PacketType) {
+	// AVL data
+	case Codec8, Codec8E:
+		records, err := ParseAVLData(uint8(p.PacketType), p.Payload)
+		// The tracker resends the whole packet unless all records are acknowledged, and a packet which
+		// could not be parsed would fail again, so it is acknowledged with its declared count and dropped
+		if err != nil {
+			if len(p.Payload) > 0 {
+				SendAck(t.Conn, int(p.Payload[0]))
+			}
+			return nil, fmt.Errorf("dropped AVL data which failed to parse: %v", err)
+		}
+		log.Printf("%v: Received %v AVL records\n", t.Id, len(records))
+		SendAck(t.Conn, len(records))
+		events := []protocols.Event{{Heartbeat: true}}
+		for i := range records {
+			rec := records[i]
+			if alarm, ok := ParseAlarm(rec); ok {
+				events = append(events, protocols.Event{Alarm: &alarm})
+			}
+			events = append(events, protocols.Event{Location: &rec.Location})
+		}
+		// Store terminal status of the latest record
+		if len(records) > 0 {
+			if ts, ok := ParseStatus(records[len(records)-1]); ok {
+				events = append(events, protocols.Event{Status: &ts})
+			}
+		}
+		return events, nil
+	// Command response
+	case Codec12:
+		r, err := ParseCmdRes(p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse command response: %v", err)
+		}
+		return []protocols.Event{{CmdResponse: &protocols.CmdResponse{Text: r}}}, nil
+	// Unknown
+	default:
+		log.Printf("%v: Unknown codec: %x\nPayload:%v", t.Id, p.PacketType, p.Payload)
+	}
+	return nil, nil
+}
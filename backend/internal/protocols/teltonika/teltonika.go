@@ -0,0 +1,318 @@
+package teltonika
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"banjo.dev/trackerr/internal/database"
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Constants specific to Teltonika
+const (
+	StartByte           byte    = 0x00
+	coordinatePrecision float64 = 10000000
+	// Not a codec, used as packet type of the IMEI sent when connecting
+	MsgTypeIMEI  uint16 = 0x0100
+	Codec8       uint8  = 0x08
+	Codec8E      uint8  = 0x8E
+	Codec12      uint8  = 0x0C
+	CmdTypeSend  uint8  = 0x05
+	CmdTypeReply uint8  = 0x06
+	imeiAccept   byte   = 0x01
+	imeiReject   byte   = 0x00
+	// Largest AVL data field accepted, to limit the buffer allocated for a packet
+	maxDataLength uint32 = 0xFFFF
+	// Teltonika trackers do not send heartbeats, so AVL data packets are used instead
+	// Positions are recorded at least once an hour when stopped, with the default configuration
+	HeartbeatInterval time.Duration = time.Hour
+)
+
+// AVL record priorities
+const (
+	PriorityLow   uint8 = 0
+	PriorityHigh  uint8 = 1
+	PriorityPanic uint8 = 2
+)
+
+// Known IO element ids
+const (
+	IOTotalOdometer   uint16 = 16
+	IOGSMSignal       uint16 = 21
+	IOExternalVoltage uint16 = 66
+	IOIgnition        uint16 = 239
+	IOMovement        uint16 = 240
+)
+
+// AVL record with the IO elements reported with it
+// IO holds elements of 1, 2, 4 and 8 bytes, and IOVariable holds elements of variable length, which are only sent using Codec 8E
+type AVLRecord struct {
+	Location   model.Locationdata
+	Priority   uint8
+	EventId    uint16
+	IO         map[uint16]uint64
+	IOVariable map[uint16][]byte
+}
+
+// Perform Teltonika authentication after receiving the IMEI p
+// The IMEI is accepted if the tracker is registered and enabled
+func PerformAuth(conn net.Conn, p model.Packet) (string, error) {
+	if p.PacketType != MsgTypeIMEI {
+		return "", fmt.Errorf("expected imei, received codec %#02x", p.PacketType)
+	}
+	imei := string(p.Payload)
+	if !database.IsTrackerEnabled(imei) {
+		conn.Write([]byte{imeiReject})
+		return "", fmt.Errorf("tracker %v is not registered or disabled", imei)
+	}
+	conn.Write([]byte{imeiAccept})
+	return imei, nil
+}
+
+// Parse Teltonika message, after the first byte has been read
+// The IMEI is sent as length(2) and IMEI, and AVL data packets as preamble(4) of zeros, data length(4),
+// data starting with the codec id and CRC-16/IBM(4) of the data.
+// The packet type of AVL data packets is the codec id, and the payload is the data following it
+func ParseMsg(conn io.Reader) (model.Packet, error) {
+	var p model.Packet
+	b, err := utils.ReadBytes(conn, 1)
+	if err != nil {
+		return p, fmt.Errorf("failed to read second byte: %v", err)
+	}
+	// IMEI length is a 2 byte length with a first byte of zero
+	if b[0] != 0 {
+		imei, err := utils.ReadBytes(conn, int(b[0]))
+		if err != nil {
+			return p, fmt.Errorf("failed to read imei: %v", err)
+		}
+		for _, c := range imei {
+			if c < '0' || c > '9' {
+				return p, fmt.Errorf("invalid imei: %q", imei)
+			}
+		}
+		p.PacketType = MsgTypeIMEI
+		p.PayloadLength = uint16(len(imei))
+		p.Payload = imei
+		return p, nil
+	}
+	// Read the rest of the preamble and the data length
+	header, err := utils.ReadBytes(conn, 6)
+	if err != nil {
+		return p, fmt.Errorf("failed to read header: %v", err)
+	}
+	if header[0] != 0 || header[1] != 0 {
+		return p, fmt.Errorf("invalid preamble")
+	}
+	length := binary.BigEndian.Uint32(header[2:6])
+	if length < 1 || length > maxDataLength {
+		return p, fmt.Errorf("invalid data length: %v", length)
+	}
+	data, err := utils.ReadBytes(conn, int(length))
+	if err != nil {
+		return p, fmt.Errorf("error reading data: %v", err)
+	}
+	crc, err := utils.ReadBytes(conn, 4)
+	if err != nil {
+		return p, fmt.Errorf("error reading crc: %v", err)
+	}
+	p.ErrorCheck = uint16(binary.BigEndian.Uint32(crc))
+	if utils.CRC16IBM(data) != p.ErrorCheck {
+		return p, fmt.Errorf("invalid error check code")
+	}
+	p.PacketType = uint16(data[0])
+	p.PayloadLength = uint16(length)
+	p.Payload = data[1:]
+	return p, nil
+}
+
+// Reader of big endian values, which keeps the first error
+type reader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.b) {
+		r.err = fmt.Errorf("data too short: %v bytes, needed %v at offset %v", len(r.b), n, r.off)
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// Read unsigned integer of n bytes
+func (r *reader) uint(n int) uint64 {
+	var v uint64
+	for _, b := range r.bytes(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// Parse AVL data of codec 8 or 8E
+// Data is count(1), count AVL records and count(1) again
+// Records are timestamp in ms(8), priority(1), lon(4), lat(4), altitude(2), angle(2), satellites(1), speed(2)
+// followed by the IO elements. Codec 8E uses 2 byte ids and counts in the IO elements
+func ParseAVLData(codec uint8, payload []byte) ([]AVLRecord, error) {
+	if codec != Codec8 && codec != Codec8E {
+		return nil, fmt.Errorf("unsupported codec: %#02x", codec)
+	}
+	r := &reader{b: payload}
+	count := int(r.uint(1))
+	records := make([]AVLRecord, 0, count)
+	for n := 0; n < count; n++ {
+		var rec AVLRecord
+		ld := &rec.Location
+		ld.Timestamp = int64(r.uint(8)) / 1000
+		rec.Priority = uint8(r.uint(1))
+		ld.Lon = int32(r.uint(4))
+		ld.Lat = int32(r.uint(4))
+		ld.Altitude = uint16(r.uint(2))
+		ld.Heading = uint16(r.uint(2))
+		satellites := uint8(r.uint(1))
+		ld.Satellites = &satellites
+		ld.Speed = uint16(r.uint(2))
+		start := r.off
+		parseIOElements(r, &rec, codec == Codec8E)
+		if r.err != nil {
+			return records, fmt.Errorf("record %v: %v", n, r.err)
+		}
+		ld.AdditionalInfo = payload[start:r.off]
+		utils.StdLatLon(ld, coordinatePrecision)
+		applyIOElements(&rec)
+		records = append(records, rec)
+	}
+	if r.uint(1) != uint64(count) || r.err != nil {
+		return records, fmt.Errorf("record count mismatch")
+	}
+	return records, nil
+}
+
+// Parse IO elements into rec
+// Elements are event id, total count, and groups of 1, 2, 4 and 8 byte values of count, followed by count id and value pairs.
+// Codec 8E adds a group of variable length values, which have a 2 byte length before the value
+func parseIOElements(r *reader, rec *AVLRecord, extended bool) {
+	size := 1
+	if extended {
+		size = 2
+	}
+	rec.EventId = uint16(r.uint(size))
+	r.uint(size) // Total count of IO elements
+	rec.IO = make(map[uint16]uint64)
+	for _, valueSize := range []int{1, 2, 4, 8} {
+		count := int(r.uint(size))
+		for i := 0; i < count && r.err == nil; i++ {
+			id := uint16(r.uint(size))
+			rec.IO[id] = r.uint(valueSize)
+		}
+	}
+	if !extended {
+		return
+	}
+	rec.IOVariable = make(map[uint16][]byte)
+	count := int(r.uint(2))
+	for i := 0; i < count && r.err == nil; i++ {
+		id := uint16(r.uint(2))
+		rec.IOVariable[id] = r.bytes(int(r.uint(2)))
+	}
+}
+
+// Decode the known IO elements into the location of rec
+// All elements remain available in rec.IO and the location's AdditionalInfo
+func applyIOElements(rec *AVLRecord) {
+	ld := &rec.Location
+	if v, ok := rec.IO[IOGSMSignal]; ok {
+		signal := uint8(v)
+		ld.SignalStrength = &signal
+	}
+	// Odometer is reported in meters, and mileage is stored in 0.1 km
+	if v, ok := rec.IO[IOTotalOdometer]; ok {
+		mileage := uint32(v / 100)
+		ld.Mileage = &mileage
+	}
+}
+
+// Get terminal status from the IO elements of rec
+// Returns false if rec does not contain any of the elements used for the status
+func ParseStatus(rec AVLRecord) (model.TerminalStatus, bool) {
+	ignition, hasIgnition := rec.IO[IOIgnition]
+	voltage, hasVoltage := rec.IO[IOExternalVoltage]
+	signal, hasSignal := rec.IO[IOGSMSignal]
+	if !hasIgnition && !hasVoltage && !hasSignal {
+		return model.TerminalStatus{}, false
+	}
+	return model.TerminalStatus{
+		Timestamp:   rec.Location.Timestamp,
+		GPSTracking: rec.Location.Satellites != nil && *rec.Location.Satellites > 0,
+		ACC:         ignition == 1,
+		// External voltage is reported in mV and stored in 0.01V
+		ExternalVoltage: uint16(voltage / 10),
+		GSMSignal:       uint8(signal),
+	}, true
+}
+
+// Get alarm of record sent with panic priority
+func ParseAlarm(rec AVLRecord) (model.Alarm, bool) {
+	if rec.Priority != PriorityPanic {
+		return model.Alarm{}, false
+	}
+	return model.Alarm{
+		Timestamp: rec.Location.Timestamp,
+		Type:      rec.EventId,
+		Name:      "Panic",
+		Lat:       rec.Location.Lat,
+		Lon:       rec.Location.Lon,
+	}, true
+}
+
+// Parse codec 12 response
+// Data is count(1), type(1), response length(4), response and count(1) again
+func ParseCmdRes(payload []byte) (string, error) {
+	r := &reader{b: payload}
+	r.uint(1)
+	cmdType := uint8(r.uint(1))
+	response := r.bytes(int(r.uint(4)))
+	r.uint(1)
+	if r.err != nil {
+		return "", r.err
+	}
+	if cmdType != CmdTypeReply {
+		return "", fmt.Errorf("unexpected command type: %#02x", cmdType)
+	}
+	return string(response), nil
+}
+
+// Send AVL data acknowledgement, which is the number of records received
+func SendAck(conn net.Conn, count int) {
+	ack := make([]byte, 4)
+	binary.BigEndian.PutUint32(ack, uint32(count))
+	conn.Write(ack)
+}
+
+// Send message with data starting with the codec id
+func SendMsg(conn net.Conn, data []byte) {
+	buf := bytes.NewBuffer([]byte{0, 0, 0, 0})
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, uint32(utils.CRC16IBM(data)))
+	conn.Write(buf.Bytes())
+}
+
+// Send command using codec 12
+func SendCmd(conn net.Conn, content string) {
+	data := bytes.NewBuffer([]byte{Codec12, 1, CmdTypeSend})
+	binary.Write(data, binary.BigEndian, uint32(len(content)))
+	data.WriteString(content)
+	data.WriteByte(1)
+	SendMsg(conn, data.Bytes())
+}
@@ -0,0 +1,132 @@
+package teltonika
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+)
+
+// Read frame from hex, after the first byte as read by the protocol registry
+func readFrame(t *testing.T, frame string) ([]byte, uint16) {
+	t.Helper()
+	b, err := hex.DecodeString(frame)
+	if err != nil {
+		t.Fatalf("invalid hex: %v", err)
+	}
+	p, err := ParseMsg(bytes.NewReader(b[1:]))
+	if err != nil {
+		t.Fatalf("ParseMsg: %v", err)
+	}
+	return p.Payload, p.PacketType
+}
+
+func TestParseMsgIMEI(t *testing.T) {
+	b, _ := hex.DecodeString("000F333536333037303432343431303133")
+	p, err := ParseMsg(bytes.NewReader(b[1:]))
+	if err != nil {
+		t.Fatalf("ParseMsg: %v", err)
+	}
+	if p.PacketType != MsgTypeIMEI || string(p.Payload) != "356307042441013" {
+		t.Errorf("got type %#x imei %q", p.PacketType, p.Payload)
+	}
+}
+
+// Frames are the examples of the Teltonika data sending protocols documentation
+func TestParseAVLData(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     string
+		codec     uint8
+		timestamp int64
+		priority  uint8
+		eventId   uint16
+		io        map[uint16]uint64
+		mileage   uint32
+	}{
+		{
+			name:      "codec 8",
+			frame:     "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF",
+			codec:     Codec8,
+			timestamp: 1560161086,
+			priority:  PriorityHigh,
+			eventId:   1,
+			io:        map[uint16]uint64{21: 3, 1: 1, 66: 0x5E0F, 241: 0x601A, 78: 0},
+		},
+		{
+			name:      "codec 8E",
+			frame:     "000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994",
+			codec:     Codec8E,
+			timestamp: 1560166592,
+			priority:  PriorityHigh,
+			eventId:   1,
+			io:        map[uint16]uint64{1: 1, 17: 0x1D, 16: 0x015E2C88, 11: 0x3544C87A, 14: 0x1DD7E06A},
+			mileage:   0x015E2C88 / 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, codec := readFrame(t, tt.frame)
+			if uint8(codec) != tt.codec {
+				t.Fatalf("codec = %#x, want %#x", codec, tt.codec)
+			}
+			records, err := ParseAVLData(tt.codec, payload)
+			if err != nil {
+				t.Fatalf("ParseAVLData: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("got %v records, want 1", len(records))
+			}
+			rec := records[0]
+			if rec.Location.Timestamp != tt.timestamp || rec.Priority != tt.priority || rec.EventId != tt.eventId {
+				t.Errorf("got timestamp %v priority %v event %v", rec.Location.Timestamp, rec.Priority, rec.EventId)
+			}
+			for id, want := range tt.io {
+				if got, ok := rec.IO[id]; !ok || got != want {
+					t.Errorf("io %v = %v, want %v", id, got, want)
+				}
+			}
+			if tt.mileage != 0 && (rec.Location.Mileage == nil || *rec.Location.Mileage != tt.mileage) {
+				t.Errorf("mileage = %v, want %v", rec.Location.Mileage, tt.mileage)
+			}
+		})
+	}
+}
+
+func TestParseAVLDataTruncated(t *testing.T) {
+	payload, codec := readFrame(t, "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF")
+	if _, err := ParseAVLData(uint8(codec), payload[:len(payload)-10]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
+
+func TestParseCmdRes(t *testing.T) {
+	payload, codec := readFrame(t, "00000000000000370C01060000002F4449313A31204449323A30204449333A302041494E313A302041494E323A313639323420444F313A3020444F323A3101000066E3")
+	if uint8(codec) != Codec12 {
+		t.Fatalf("codec = %#x, want %#x", codec, Codec12)
+	}
+	r, err := ParseCmdRes(payload)
+	if err != nil {
+		t.Fatalf("ParseCmdRes: %v", err)
+	}
+	if want := "DI1:1 DI2:0 DI3:0 AIN1:0 AIN2:16924 DO1:0 DO2:1"; r != want {
+		t.Errorf("response = %q, want %q", r, want)
+	}
+}
+
+func TestSendCmd(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		SendCmd(server, "getinfo")
+		server.Close()
+	}()
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if want := "000000000000000f0c010500000007676574696e666f0100004312"; hex.EncodeToString(got) != want {
+		t.Errorf("command = %x, want %v", got, want)
+	}
+}
@@ -0,0 +1,250 @@
+package tk103
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/protocols"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// TK103 protocol registered with the protocol registry
+type Protocol struct{}
+
+func init() {
+	protocols.Register(Protocol{})
+}
+
+func (Protocol) Type() int {
+	return utils.ProtocolTypeTK103
+}
+
+func (Protocol) Name() string {
+	return "TK103"
+}
+
+// Coban messages start with ## when logging in, imei: for reports and the IMEI for heartbeats
+func (Protocol) Detect(start byte) bool {
+	return start == StartByteXexun || start == '#' || start == 'i' || (start >= '0' && start <= '9')
+}
+
+func (Protocol) ReadFrame(conn net.Conn, start byte) (model.Packet, error) {
+	return ParseMsg(conn, start)
+}
+
+func (Protocol) PerformAuth(conn net.Conn, p model.Packet) (string, uint8, error) {
+	id, err := PerformAuth(p)
+	return id, 0, err
+}
+
+// Logins are answered and may contain a position, so the first message is always decoded
+func (Protocol) DecodeFirst(p model.Packet) bool {
+	return true
+}
+
+func (Protocol) HeartbeatInterval() time.Duration {
+	return HeartbeatInterval
+}
+
+func (Protocol) NewSession(t *model.TrackerHandler) protocols.Session {
+	return &Session{t: t, format: FormatCoban}
+}
+
+// Connection to a TK103 tracker
+type Session struct {
+	t *model.TrackerHandler
+	// Format of the messages sent by the tracker, which is also used for commands
+	format byte
+	// Coban commands waiting for a response, in the order they were sent
+	cobanCommands []cobanCommand
+	// Id of the last Coban command sent
+	lastCmdId uint32
+}
+
+// Coban command waiting for the report with keyword which answers it
+// Commands with an unknown response keyword have no keyword, and are answered by the next report which answers no other command
+type cobanCommand struct {
+	id       uint32
+	keyword  string
+	deadline time.Time
+}
+
+func (s *Session) SendCommand(command string) (uint32, error) {
+	SendCmd(s.t.Conn, s.format, s.t.Id, command)
+	// Xexun responses do not refer to the command, so they are matched in order
+	if s.format != FormatCoban {
+		return 0, nil
+	}
+	// Drop the oldest command if too many are waiting for a response
+	if len(s.cobanCommands) >= maxCobanCommands {
+		s.cobanCommands = s.cobanCommands[1:]
+	}
+	deadline := time.Now().Add(cobanCmdTimeout)
+	keyword, ok := CobanResponseKeyword(command)
+	if !ok {
+		s.cobanCommands = append(s.cobanCommands, cobanCommand{deadline: deadline})
+		return 0, nil
+	}
+	// Coban responses with a known keyword are matched by it, to not take other reports as responses
+	s.lastCmdId++
+	s.cobanCommands = append(s.cobanCommands, cobanCommand{id: s.lastCmdId, keyword: keyword, deadline: deadline})
+	return s.lastCmdId, nil
+}
+
+// Get response event if report with keyword answers a command waiting for a response
+func (s *Session) cobanResponse(keyword string, payload []byte) (protocols.Event, bool) {
+	keyword = strings.ToLower(keyword)
+	match := -1
+	for i, cmd := range s.cobanCommands {
+		if cmd.keyword == keyword {
+			match = i
+			break
+		}
+		if cmd.keyword == "" && match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return protocols.Event{}, false
+	}
+	cmd := s.cobanCommands[match]
+	s.cobanCommands = append(s.cobanCommands[:match], s.cobanCommands[match+1:]...)
+	r := &protocols.CmdResponse{Id: cmd.id, HasId: cmd.keyword != "", Text: string(payload)}
+	return protocols.Event{CmdResponse: r}, true
+}
+
+func (s *Session) SendMessage(cmd model.TrackerCommand) error {
+	return fmt.Errorf("message %#04x is not supported by TK103", cmd.MsgType)
+}
+
+// Remove Coban commands which were not answered in time
+func (s *Session) Tick(now time.Time) {
+	commands := s.cobanCommands[:0]
+	for _, cmd := range s.cobanCommands {
+		if now.Before(cmd.deadline) {
+			commands = append(commands, cmd)
+		}
+	}
+	s.cobanCommands = commands
+}
+
+func (s *Session) Decode(p model.Packet) ([]protocols.Event, error) {
+	s.format = p.Protocol
+	if p.Protocol == FormatXexun {
+		return s.decodeXexun(p)
+	}
+	return s.decodeCoban(p)
+}
+
+// Append location event of ld to events, unless it is not a valid GPS fix
+func appendLocation(events []protocols.Event, ld model.Locationdata, valid bool) []protocols.Event {
+	if !valid {
+		return events
+	}
+	return append(events, protocols.Event{Location: &ld})
+}
+
+func (s *Session) decodeXexun(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	msgType, body := ParseXexunMsg(p.Payload)
+	events := []protocols.Event{{Heartbeat: true}}
+	switch msgType {
+	// Login, with the IMEI before the position
+	case MsgTypeLogin:
+		SendXexunMsg(t.Conn, p.DeviceID, MsgTypeLoginRes, "")
+		if len(body) < 15 {
+			return events, fmt.Errorf("login too short: %v bytes", len(body))
+		}
+		log.Printf("%v: Logged in with IMEI %v\n", t.Id, body[0:15])
+		ld, valid, err := ParseGPSData(body[15:])
+		if err != nil {
+			return events, fmt.Errorf("failed to parse position: %v", err)
+		}
+		return appendLocation(events, ld, valid), nil
+	// Handshake, which is sent as heartbeat
+	case MsgTypeHandshake:
+		log.Printf("%v: Received heartbeat\n", t.Id)
+		SendXexunMsg(t.Conn, p.DeviceID, MsgTypeHandshakeRes, "HSO")
+		return events, nil
+	// Position
+	case MsgTypePosition:
+		ld, valid, err := ParseGPSData(body)
+		if err != nil {
+			return events, fmt.Errorf("failed to parse position: %v", err)
+		}
+		return appendLocation(events, ld, valid), nil
+	// Alarm, with the alarm code before the position
+	case MsgTypeAlarm:
+		if len(body) < 1 {
+			return events, fmt.Errorf("alarm is empty")
+		}
+		SendXexunMsg(t.Conn, p.DeviceID, MsgTypeAlarmRes, body[0:1])
+		ld, valid, err := ParseGPSData(body[1:])
+		if err != nil {
+			return events, fmt.Errorf("failed to parse alarm position: %v", err)
+		}
+		// Alarms without a valid GPS fix are stored without position
+		if !valid {
+			ld.Lat, ld.Lon = 0, 0
+		}
+		alarm := NewAlarm(uint16(body[0]-'0'), ld)
+		return appendLocation(append(events, protocols.Event{Alarm: &alarm}), ld, valid), nil
+	// Position queried by a command
+	case MsgTypeQueryRes:
+		events = append(events, protocols.Event{CmdResponse: &protocols.CmdResponse{Text: msgType + body}})
+		ld, valid, err := ParseGPSData(body)
+		if err != nil {
+			return events, fmt.Errorf("failed to parse position: %v", err)
+		}
+		return appendLocation(events, ld, valid), nil
+	// Other messages are responses to commands
+	default:
+		return append(events, protocols.Event{CmdResponse: &protocols.CmdResponse{Text: msgType + body}}), nil
+	}
+}
+
+func (s *Session) decodeCoban(p model.Packet) ([]protocols.Event, error) {
+	t := s.t
+	fields := strings.Split(string(p.Payload), ",")
+	events := []protocols.Event{{Heartbeat: true}}
+	// Login
+	if fields[0] == cobanLogin {
+		log.Printf("%v: Logged in\n", t.Id)
+		SendCobanMsg(t.Conn, cobanLoginRes)
+		return events, nil
+	}
+	// Heartbeat
+	if len(fields) == 1 {
+		log.Printf("%v: Received heartbeat\n", t.Id)
+		SendCobanMsg(t.Conn, cobanHeartbeatRes)
+		return events, nil
+	}
+	// Report
+	keyword, ld, hasPosition, err := ParseCobanReport(fields)
+	if event, ok := s.cobanResponse(keyword, p.Payload); ok {
+		events = append(events, event)
+	}
+	if err != nil {
+		return events, fmt.Errorf("failed to parse report: %v", err)
+	}
+	if alarmType, ok := CobanAlarmType(keyword); ok {
+		if ld.Timestamp == 0 {
+			ld.Timestamp = time.Now().Unix()
+		}
+		alarm := NewAlarm(alarmType, ld)
+		events = append(events, protocols.Event{Alarm: &alarm})
+	}
+	switch keyword {
+	case "acc on", "acc off":
+		ts := model.TerminalStatus{Timestamp: time.Now().Unix(), ACC: keyword == "acc on", GPSTracking: hasPosition}
+		events = append(events, protocols.Event{Status: &ts})
+	}
+	if hasPosition {
+		events = append(events, protocols.Event{Location: &ld})
+	}
+	return events, nil
+}
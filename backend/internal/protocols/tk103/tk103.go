@@ -0,0 +1,335 @@
+package tk103
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Constants specific to TK103
+// Coban messages are comma separated fields ending with ; and Xexun messages are enclosed in parentheses
+const (
+	FormatCoban         byte    = 'C'
+	FormatXexun         byte    = 'X'
+	StartByteXexun      byte    = '('
+	EndByteXexun        byte    = ')'
+	EndByteCoban        byte    = ';'
+	coordinatePrecision float64 = 1000000
+	knotsToKmh          float64 = 1.852
+	// Xexun messages start with a 12 digit device id followed by a 4 character message type
+	xexunIdLength       int    = 12
+	MsgTypeLogin        string = "BP05"
+	MsgTypeLoginRes     string = "AP05"
+	MsgTypeHandshake    string = "BP00"
+	MsgTypeHandshakeRes string = "AP01"
+	MsgTypePosition     string = "BR00"
+	MsgTypeQueryRes     string = "BP04"
+	MsgTypeAlarm        string = "BO01"
+	MsgTypeAlarmRes     string = "AS01"
+	// Coban login starts with ## and heartbeats are only the IMEI
+	cobanLogin        string = "##"
+	cobanLoginRes     string = "LOAD"
+	cobanHeartbeatRes string = "ON"
+	// Longest message accepted, to limit the buffer used while waiting for the end byte
+	maxLength int = 1024
+	// Trackers send a heartbeat or handshake at least every few minutes
+	HeartbeatInterval time.Duration = 10 * time.Minute
+	// Coban commands waiting for a response are removed after this time, or when too many are waiting
+	cobanCmdTimeout  time.Duration = 30 * time.Second
+	maxCobanCommands int           = 16
+)
+
+// Names of alarm types, which are the alarm codes of Xexun alarm messages
+var alarmTypes = map[uint16]string{
+	0: "Power Failure",
+	1: "Accident",
+	2: "SOS",
+	3: "Vibration",
+	4: "Low Speed",
+	5: "Speeding",
+	6: "Exiting Fence",
+	7: "Low Battery",
+	8: "Movement",
+	9: "Door Opened",
+}
+
+// Keywords of the Coban reports answering commands, keyed by the lowercased command keyword
+// Commands are acknowledged by the command keyword followed by t, and single positions by a tracker report
+var cobanCmdResponses = map[string]string{
+	// Single position
+	"b": "tracker",
+	// Cut and restore the oil supply
+	"j": "jt",
+	"k": "kt",
+	// Arm and disarm
+	"l": "lt",
+	"m": "mt",
+	// Cancel alarm
+	"e": "et",
+}
+
+// Alarm types of the keywords of Coban reports
+var cobanAlarms = map[string]uint16{
+	"ac alarm":     0,
+	"help me":      2,
+	"sensor alarm": 3,
+	"speed":        5,
+	"stockade":     6,
+	"low battery":  7,
+	"move":         8,
+	"door alarm":   9,
+}
+
+// Perform TK103 authentication after receiving first message p
+// Trackers are identified by the id sent in every message, and the login is answered when decoding it
+func PerformAuth(p model.Packet) (string, error) {
+	if p.DeviceID == "" {
+		return "", fmt.Errorf("message does not contain a device id")
+	}
+	return p.DeviceID, nil
+}
+
+// Parse TK103 message, starting with start
+// The payload is the message without the parentheses of Xexun messages or the ; of Coban messages,
+// and the format of the message is stored in p.Protocol
+func ParseMsg(conn io.Reader, start byte) (model.Packet, error) {
+	p := model.Packet{Protocol: FormatCoban}
+	end := EndByteCoban
+	var text []byte
+	if start == StartByteXexun {
+		p.Protocol = FormatXexun
+		end = EndByteXexun
+	} else {
+		text = append(text, start)
+	}
+	// Read one byte at a time, to not consume the following message
+	for {
+		b, err := utils.ReadBytes(conn, 1)
+		if err != nil {
+			return p, fmt.Errorf("failed to read message: %v", err)
+		}
+		if b[0] == end {
+			break
+		}
+		if len(text) >= maxLength {
+			return p, fmt.Errorf("message exceeds %v bytes", maxLength)
+		}
+		text = append(text, b[0])
+	}
+	p.Payload = text
+	p.PayloadLength = uint16(len(text))
+	if p.Protocol == FormatXexun {
+		if len(text) < xexunIdLength+4 {
+			return p, fmt.Errorf("invalid message: %q", text)
+		}
+		p.DeviceID = string(text[:xexunIdLength])
+		return p, nil
+	}
+	fields := strings.Split(string(text), ",")
+	switch {
+	case fields[0] == cobanLogin && len(fields) > 1:
+		p.DeviceID = strings.TrimPrefix(fields[1], "imei:")
+	case strings.HasPrefix(fields[0], "imei:"):
+		p.DeviceID = strings.TrimPrefix(fields[0], "imei:")
+	case len(fields) == 1 && isDigits(fields[0]):
+		p.DeviceID = fields[0]
+	default:
+		return p, fmt.Errorf("invalid message: %q", text)
+	}
+	return p, nil
+}
+
+// Split Xexun message payload into its type and body
+func ParseXexunMsg(payload []byte) (string, string) {
+	return string(payload[xexunIdLength : xexunIdLength+4]), string(payload[xexunIdLength+4:])
+}
+
+// Parse Xexun GPS data
+// Data is date(YYMMDD), validity(A/V), lat(DDMM.MMMM), N/S, lon(DDDMM.MMMM), E/W, speed in km/h(5), time(HHMMSS), course(6),
+// io state(8), followed by L and the mileage in meters as 8 hex digits
+// Returns false if the position is not a valid GPS fix, in which case it is the last known position
+func ParseGPSData(data string) (model.Locationdata, bool, error) {
+	var ld model.Locationdata
+	if len(data) < 45 {
+		return ld, false, fmt.Errorf("gps data too short: %v bytes", len(data))
+	}
+	lat, err := parseCoordinate(data[7:16], data[16] == 'S')
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid latitude: %v", err)
+	}
+	lon, err := parseCoordinate(data[17:27], data[27] == 'W')
+	if err != nil {
+		return ld, false, fmt.Errorf("invalid longitude: %v", err)
+	}
+	speed, _ := strconv.ParseFloat(data[28:33], 64)
+	course, _ := strconv.ParseFloat(data[39:45], 64)
+	ld.Timestamp = parseTime(data[0:6], data[33:39])
+	ld.Lat = lat
+	ld.Lon = lon
+	ld.Speed = uint16(speed)
+	ld.Heading = uint16(course)
+	if len(data) >= 53 {
+		if status, err := strconv.ParseUint(data[45:53], 2, 32); err == nil {
+			ld.Status = uint32(status)
+		}
+	}
+	if len(data) >= 62 && data[53] == 'L' {
+		if meters, err := strconv.ParseUint(data[54:62], 16, 32); err == nil {
+			// Mileage is stored in 0.1 km
+			mileage := uint32(meters / 100)
+			ld.Mileage = &mileage
+		}
+	}
+	utils.StdLatLon(&ld, coordinatePrecision)
+	return ld, data[6] == 'A', nil
+}
+
+// Get alarm of alarmType at position ld
+func NewAlarm(alarmType uint16, ld model.Locationdata) model.Alarm {
+	alarm := model.Alarm{
+		Timestamp: ld.Timestamp,
+		Type:      alarmType,
+		Name:      "Unknown",
+		Lat:       ld.Lat,
+		Lon:       ld.Lon,
+	}
+	if name, ok := alarmTypes[alarmType]; ok {
+		alarm.Name = name
+	}
+	return alarm
+}
+
+// Parse Coban report
+// Fields are imei:<imei>, keyword, local time(YYMMDDhhmm), phone number, F/L for GPS or LBS, time(hhmmss.sss), validity(A/V),
+// lat(DDMM.MMMM), N/S, lon(DDDMM.MMMM), E/W, speed in knots, course
+// Returns the keyword, and false if the report does not contain a valid GPS position
+func ParseCobanReport(fields []string) (string, model.Locationdata, bool, error) {
+	var ld model.Locationdata
+	if len(fields) < 2 {
+		return "", ld, false, fmt.Errorf("report has %v fields", len(fields))
+	}
+	keyword := fields[1]
+	if len(fields) < 13 || fields[4] != "F" {
+		return keyword, ld, false, nil
+	}
+	if len(fields[2]) >= 10 && len(fields[5]) >= 6 {
+		ld.Timestamp = parseCobanTime(fields[2], fields[5])
+	}
+	if fields[6] != "A" {
+		return keyword, ld, false, nil
+	}
+	lat, err := parseCoordinate(fields[7], fields[8] == "S")
+	if err != nil {
+		return keyword, ld, false, fmt.Errorf("invalid latitude: %v", err)
+	}
+	lon, err := parseCoordinate(fields[9], fields[10] == "W")
+	if err != nil {
+		return keyword, ld, false, fmt.Errorf("invalid longitude: %v", err)
+	}
+	speed, _ := strconv.ParseFloat(fields[11], 64)
+	course, _ := strconv.ParseFloat(fields[12], 64)
+	ld.Lat = lat
+	ld.Lon = lon
+	ld.Speed = uint16(speed * knotsToKmh)
+	ld.Heading = uint16(course)
+	utils.StdLatLon(&ld, coordinatePrecision)
+	return keyword, ld, true, nil
+}
+
+// Get alarm type of Coban report keyword
+func CobanAlarmType(keyword string) (uint16, bool) {
+	alarmType, ok := cobanAlarms[keyword]
+	return alarmType, ok
+}
+
+// Get keyword of the Coban report answering command
+// Returns false if the response keyword of the command is not known
+func CobanResponseKeyword(command string) (string, bool) {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(command), ",")
+	response, ok := cobanCmdResponses[strings.ToLower(keyword)]
+	return response, ok
+}
+
+// Parse coordinate of format (D)DDMM.MMMM, which is negated if negative is set
+func parseCoordinate(s string, negative bool) (int32, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	degrees := float64(int(v / 100))
+	minutes := v - degrees*100
+	c := int32((degrees + minutes/60) * coordinatePrecision)
+	if negative {
+		c = -c
+	}
+	return c, nil
+}
+
+// Convert date of format YYMMDD and time of format HHMMSS to unix time
+func parseTime(ymd string, hms string) int64 {
+	t, err := time.Parse("060102150405", ymd+hms)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Convert time of Coban report to unix time
+// The date is only sent in local time(YYMMDDhhmm), while the time is UTC(hhmmss), so the date
+// is moved a day when the local and UTC hours show that midnight is between them
+func parseCobanTime(local string, utc string) int64 {
+	ts := parseTime(local[0:6], utc[0:6])
+	if ts == 0 {
+		return 0
+	}
+	localHour, errLocal := strconv.Atoi(local[6:8])
+	utcHour, errUTC := strconv.Atoi(utc[0:2])
+	if errLocal != nil || errUTC != nil {
+		return ts
+	}
+	switch diff := localHour - utcHour; {
+	// Local time is ahead of UTC and past midnight
+	case diff < -12:
+		ts -= 24 * 60 * 60
+	// Local time is behind UTC and before midnight
+	case diff > 12:
+		ts += 24 * 60 * 60
+	}
+	return ts
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Send Xexun message of msgType to tracker with id
+func SendXexunMsg(conn net.Conn, id string, msgType string, body string) {
+	conn.Write([]byte(string(StartByteXexun) + id + msgType + body + string(EndByteXexun)))
+}
+
+// Send Coban message
+func SendCobanMsg(conn net.Conn, msg string) {
+	conn.Write([]byte(msg))
+}
+
+// Send command in the format used by the tracker
+// Xexun commands are the message type followed by its body, such as "AV011" to cut the oil supply,
+// and Coban commands are the keyword followed by its parameters, such as "C,30s" to report every 30 seconds
+func SendCmd(conn net.Conn, format byte, id string, command string) {
+	if format == FormatXexun {
+		SendXexunMsg(conn, id, "", command)
+		return
+	}
+	SendCobanMsg(conn, "**,imei:"+id+","+command+string(EndByteCoban))
+}
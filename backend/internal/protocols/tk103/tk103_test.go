@@ -0,0 +1,190 @@
+package tk103
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"banjo.dev/trackerr/internal/model"
+	"banjo.dev/trackerr/internal/utils"
+)
+
+// Read frame, after the start byte as read by the protocol registry
+func readFrame(t *testing.T, frame string) model.Packet {
+	t.Helper()
+	p, err := ParseMsg(bytes.NewReader([]byte(frame[1:])), frame[0])
+	if err != nil {
+		t.Fatalf("ParseMsg: %v", err)
+	}
+	return p
+}
+
+// Check that coordinate c is deg degrees, within the precision of the standard coordinates
+func checkCoordinate(t *testing.T, name string, c int32, deg float64) {
+	t.Helper()
+	got := float64(utils.FromStdCoordinate(c, coordinatePrecision)) / coordinatePrecision
+	if diff := got - deg; diff > 0.00001 || diff < -0.00001 {
+		t.Errorf("%v = %v, want %v", name, got, deg)
+	}
+}
+
+func unix(s string) int64 {
+	t, _ := time.Parse(time.DateTime, s)
+	return t.Unix()
+}
+
+// Frames are the examples of the Xexun protocol documentation
+func TestParseXexunMsg(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		msgType string
+		// Length of the data before the GPS data
+		prefix int
+		valid  bool
+		lat    float64
+		lon    float64
+	}{
+		{
+			name:    "login",
+			frame:   "(000000000000BP05000000000000000080816A2232.9806N11404.9355E000.1101241323.8700000000L0000024B)",
+			msgType: MsgTypeLogin,
+			prefix:  15,
+			valid:   true,
+			lat:     22.549677,
+			lon:     114.082258,
+		},
+		{
+			name:    "alarm",
+			frame:   "(000000000000BO012080816A2232.9806N11404.9355E000.1101241323.8700000000L0000024B)",
+			msgType: MsgTypeAlarm,
+			prefix:  1,
+			valid:   true,
+			lat:     22.549677,
+			lon:     114.082258,
+		},
+		{
+			name:    "alarm without fix",
+			frame:   "(000000000000BO012080816V2232.9806S11404.9355W000.1101241323.8700000000L0000024B)",
+			msgType: MsgTypeAlarm,
+			prefix:  1,
+			valid:   false,
+			lat:     -22.549677,
+			lon:     -114.082258,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := readFrame(t, tt.frame)
+			if p.Protocol != FormatXexun || p.DeviceID != "000000000000" {
+				t.Errorf("got format %c device id %v", p.Protocol, p.DeviceID)
+			}
+			msgType, body := ParseXexunMsg(p.Payload)
+			if msgType != tt.msgType {
+				t.Fatalf("type = %v, want %v", msgType, tt.msgType)
+			}
+			ld, valid, err := ParseGPSData(body[tt.prefix:])
+			if err != nil {
+				t.Fatalf("ParseGPSData: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("valid = %v, want %v", valid, tt.valid)
+			}
+			checkCoordinate(t, "lat", ld.Lat, tt.lat)
+			checkCoordinate(t, "lon", ld.Lon, tt.lon)
+			if ld.Timestamp != unix("2008-08-16 10:12:41") || ld.Heading != 323 {
+				t.Errorf("got time %v heading %v", ld.Timestamp, ld.Heading)
+			}
+			if ld.Mileage == nil || *ld.Mileage != 5 {
+				t.Errorf("mileage = %v, want 5", ld.Mileage)
+			}
+		})
+	}
+}
+
+func TestParseCobanReport(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     string
+		keyword   string
+		lat, lon  float64
+		speed     uint16
+		timestamp int64
+	}{
+		{
+			name:      "same day",
+			frame:     "imei:359710049095095,tracker,2410171230,,F,043000.000,A,2232.9806,N,11404.9355,E,10.00,90;",
+			keyword:   "tracker",
+			lat:       22.549677,
+			lon:       114.082258,
+			speed:     18,
+			timestamp: unix("2024-10-17 04:30:00"),
+		},
+		{
+			name:      "local time after midnight",
+			frame:     "imei:359710049095095,tracker,2410170130,,F,173000.000,A,2232.9806,N,11404.9355,E,10.00,90;",
+			keyword:   "tracker",
+			lat:       22.549677,
+			lon:       114.082258,
+			speed:     18,
+			timestamp: unix("2024-10-16 17:30:00"),
+		},
+		{
+			name:      "local time before midnight",
+			frame:     "imei:359710049095095,help me,2410162030,,F,013000.000,A,2232.9806,S,11404.9355,W,0.00,0;",
+			keyword:   "help me",
+			lat:       -22.549677,
+			lon:       -114.082258,
+			timestamp: unix("2024-10-17 01:30:00"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := readFrame(t, tt.frame)
+			if p.Protocol != FormatCoban || p.DeviceID != "359710049095095" {
+				t.Errorf("got format %c device id %v", p.Protocol, p.DeviceID)
+			}
+			keyword, ld, hasPosition, err := ParseCobanReport(strings.Split(string(p.Payload), ","))
+			if err != nil {
+				t.Fatalf("ParseCobanReport: %v", err)
+			}
+			if keyword != tt.keyword || !hasPosition {
+				t.Errorf("got keyword %q position %v", keyword, hasPosition)
+			}
+			checkCoordinate(t, "lat", ld.Lat, tt.lat)
+			checkCoordinate(t, "lon", ld.Lon, tt.lon)
+			if ld.Speed != tt.speed || ld.Timestamp != tt.timestamp {
+				t.Errorf("got speed %v time %v", ld.Speed, time.Unix(ld.Timestamp, 0).UTC())
+			}
+		})
+	}
+}
+
+func TestParseCobanReportLBS(t *testing.T) {
+	p := readFrame(t, "imei:359710049095095,tracker,2410170130,,L,,,24c5,,cf1d,,,;")
+	keyword, _, hasPosition, err := ParseCobanReport(strings.Split(string(p.Payload), ","))
+	if err != nil || keyword != "tracker" || hasPosition {
+		t.Errorf("got keyword %q position %v error %v", keyword, hasPosition, err)
+	}
+}
+
+func TestCobanResponseKeyword(t *testing.T) {
+	tests := []struct {
+		command string
+		keyword string
+		ok      bool
+	}{
+		{"B", "tracker", true},
+		{"j", "jt", true},
+		{"K", "kt", true},
+		{"e,123456", "et", true},
+		{"**,imei:359710049095095,C,30s", "", false},
+	}
+	for _, tt := range tests {
+		keyword, ok := CobanResponseKeyword(tt.command)
+		if keyword != tt.keyword || ok != tt.ok {
+			t.Errorf("CobanResponseKeyword(%q) = %q, %v, want %q, %v", tt.command, keyword, ok, tt.keyword, tt.ok)
+		}
+	}
+}
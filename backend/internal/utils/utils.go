@@ -15,6 +15,10 @@ const coordinatePrecision = 2000000
 const (
 	ProtocolTypeGT06 int = iota
 	ProtocolTypeJT808
+	ProtocolTypeTeltonika
+	ProtocolTypeH02
+	ProtocolTypeTK103
+	ProtocolTypeQueclink
 )
 
 type NullTime struct {
@@ -23,16 +27,22 @@ type NullTime struct {
 }
 
 // Convert coordinates to printable string
-func StringifyCoordinates(lat uint32, lon uint32) string {
+func StringifyCoordinates(lat int32, lon int32) string {
 	lat_deg := float64(lat) / float64(coordinatePrecision)
 	lon_deg := float64(lon) / float64(coordinatePrecision)
 	return fmt.Sprintf("%.5f, %.5f", lat_deg, lon_deg)
 }
 
 // Convert coordinates of inPrecision to CoordinatePrecision
+// Southern latitudes and western longitudes are negative
 func StdLatLon(ld *model.Locationdata, inPrecision float64) {
-	ld.Lat = uint32(float64(ld.Lat) * (float64(coordinatePrecision) / inPrecision))
-	ld.Lon = uint32(float64(ld.Lon) * (float64(coordinatePrecision) / inPrecision))
+	ld.Lat = int32(float64(ld.Lat) * (float64(coordinatePrecision) / inPrecision))
+	ld.Lon = int32(float64(ld.Lon) * (float64(coordinatePrecision) / inPrecision))
+}
+
+// Convert coordinate of CoordinatePrecision to outPrecision
+func FromStdCoordinate(v int32, outPrecision float64) int32 {
+	return int32(float64(v) * (outPrecision / float64(coordinatePrecision)))
 }
 
 // Read x bytes from r
@@ -85,3 +95,19 @@ func CRCITU(data []byte) uint16 {
 	}
 	return ^fcs
 }
+
+// Perform CRC-16/IBM calculating, using the reversed polynomial 0xA001
+func CRC16IBM(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
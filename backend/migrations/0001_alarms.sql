@@ -0,0 +1,14 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "alarms" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"lat"	INTEGER NOT NULL,
+	"lon"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_alarms_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 1;
+COMMIT;
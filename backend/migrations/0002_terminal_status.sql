@@ -0,0 +1,19 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "terminal_status" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"oilCut"	INTEGER NOT NULL,
+	"gpsTracking"	INTEGER NOT NULL,
+	"alarm"	INTEGER NOT NULL,
+	"charging"	INTEGER NOT NULL,
+	"acc"	INTEGER NOT NULL,
+	"defense"	INTEGER NOT NULL,
+	"voltageLevel"	INTEGER NOT NULL,
+	"externalVoltage"	INTEGER NOT NULL,
+	"gsmSignal"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_terminal_status_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 2;
+COMMIT;
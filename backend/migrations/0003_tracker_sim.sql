@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+ALTER TABLE "trackers" ADD COLUMN "imsi" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "trackers" ADD COLUMN "iccid" TEXT NOT NULL DEFAULT '';
+PRAGMA user_version = 3;
+COMMIT;
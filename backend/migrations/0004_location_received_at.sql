@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+ALTER TABLE "location_data" ADD COLUMN "receivedAt" INTEGER NOT NULL DEFAULT 0;
+-- Existing rows were stored with the server receive time as timestamp
+UPDATE "location_data" SET "receivedAt" = "timestamp";
+PRAGMA user_version = 4;
+COMMIT;
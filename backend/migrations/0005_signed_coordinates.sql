@@ -0,0 +1,10 @@
+BEGIN TRANSACTION;
+-- Coordinates are now signed, with negative values for southern latitudes and western longitudes.
+-- Convert any coordinate stored as a wrapped unsigned 32 bit value into its signed equivalent.
+-- Rows stored before this change carry no hemisphere information and can not be corrected further.
+UPDATE "location_data" SET "lat" = "lat" - 4294967296 WHERE "lat" >= 2147483648;
+UPDATE "location_data" SET "lon" = "lon" - 4294967296 WHERE "lon" >= 2147483648;
+UPDATE "alarms" SET "lat" = "lat" - 4294967296 WHERE "lat" >= 2147483648;
+UPDATE "alarms" SET "lon" = "lon" - 4294967296 WHERE "lon" >= 2147483648;
+PRAGMA user_version = 5;
+COMMIT;
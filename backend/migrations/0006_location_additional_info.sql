@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+ALTER TABLE "location_data" ADD COLUMN "altitude" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "location_data" ADD COLUMN "alarmFlags" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "location_data" ADD COLUMN "status" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "location_data" ADD COLUMN "mileage" INTEGER;
+ALTER TABLE "location_data" ADD COLUMN "fuel" INTEGER;
+ALTER TABLE "location_data" ADD COLUMN "recorderSpeed" INTEGER;
+ALTER TABLE "location_data" ADD COLUMN "signalStrength" INTEGER;
+ALTER TABLE "location_data" ADD COLUMN "satellites" INTEGER;
+ALTER TABLE "location_data" ADD COLUMN "additionalInfo" BLOB;
+PRAGMA user_version = 6;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN TRANSACTION;
+ALTER TABLE "location_data" ADD COLUMN "historic" INTEGER NOT NULL DEFAULT 0;
+PRAGMA user_version = 7;
+COMMIT;
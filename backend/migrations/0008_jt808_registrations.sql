@@ -0,0 +1,16 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "jt808_registrations" (
+	"trackerId"	TEXT NOT NULL UNIQUE,
+	"timestamp"	INTEGER NOT NULL,
+	"provinceId"	INTEGER NOT NULL,
+	"cityId"	INTEGER NOT NULL,
+	"manufacturerId"	TEXT NOT NULL,
+	"terminalModel"	TEXT NOT NULL,
+	"terminalId"	TEXT NOT NULL,
+	"plateColour"	INTEGER NOT NULL,
+	"plateNumber"	TEXT NOT NULL,
+	PRIMARY KEY("trackerId"),
+	CONSTRAINT "fk_jt808_registrations_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 8;
+COMMIT;
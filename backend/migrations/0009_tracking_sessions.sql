@@ -0,0 +1,13 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "tracking_sessions" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"userId"	INTEGER NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"interval"	INTEGER NOT NULL,
+	"expiresAt"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_tracking_sessions_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 9;
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "regions" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"owner"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"type"	TEXT NOT NULL,
+	"points"	TEXT NOT NULL,
+	"radius"	INTEGER NOT NULL DEFAULT 0,
+	"width"	INTEGER NOT NULL DEFAULT 0,
+	"maxSpeed"	INTEGER,
+	"overspeedDuration"	INTEGER NOT NULL DEFAULT 0,
+	"alarmOnEnter"	INTEGER NOT NULL DEFAULT 0,
+	"alarmOnExit"	INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_regions_owner__users_id" FOREIGN KEY("owner") REFERENCES "users"("id")
+);
+CREATE TABLE IF NOT EXISTS "tracker_regions" (
+	"trackerId"	TEXT NOT NULL,
+	"regionId"	INTEGER NOT NULL,
+	"pushedAt"	INTEGER NOT NULL,
+	PRIMARY KEY("trackerId","regionId"),
+	CONSTRAINT "fk_tracker_regions_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_tracker_regions_regionId_regions_id" FOREIGN KEY("regionId") REFERENCES "regions"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 10;
+COMMIT;
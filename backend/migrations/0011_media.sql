@@ -0,0 +1,21 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "media" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"mediaId"	INTEGER NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"receivedAt"	INTEGER NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"format"	INTEGER NOT NULL,
+	"event"	INTEGER NOT NULL,
+	"channel"	INTEGER NOT NULL,
+	"lat"	INTEGER NOT NULL,
+	"lon"	INTEGER NOT NULL,
+	"alarmFlags"	INTEGER NOT NULL,
+	"path"	TEXT NOT NULL,
+	"size"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_media_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 11;
+COMMIT;
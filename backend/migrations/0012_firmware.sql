@@ -0,0 +1,28 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "firmware" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"model"	TEXT NOT NULL,
+	"version"	TEXT NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"manufacturerId"	TEXT NOT NULL,
+	"path"	TEXT NOT NULL,
+	"size"	INTEGER NOT NULL,
+	"uploadedAt"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_firmware_model__models_name" FOREIGN KEY("model") REFERENCES "models"("name") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "firmware_upgrades" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"firmwareId"	INTEGER NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"updatedAt"	INTEGER NOT NULL,
+	"status"	TEXT NOT NULL,
+	"sentPackages"	INTEGER NOT NULL,
+	"totalPackages"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_firmware_upgrades_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_firmware_upgrades_firmwareId_firmware_id" FOREIGN KEY("firmwareId") REFERENCES "firmware"("id") ON DELETE CASCADE
+);
+PRAGMA user_version = 12;
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+ALTER TABLE "alarms" ADD COLUMN "serialNumber" INTEGER;
+ALTER TABLE "alarms" ADD COLUMN "acknowledgedBy" INTEGER;
+ALTER TABLE "alarms" ADD COLUMN "acknowledgedAt" INTEGER;
+PRAGMA user_version = 13;
+COMMIT;
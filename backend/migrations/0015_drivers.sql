@@ -0,0 +1,24 @@
+BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "drivers" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"name"	TEXT NOT NULL,
+	"certificate"	TEXT NOT NULL UNIQUE,
+	"agency"	TEXT NOT NULL,
+	"certificateExpiry"	TEXT NOT NULL,
+	"idNumber"	TEXT NOT NULL DEFAULT '',
+	"lastSeen"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE TABLE IF NOT EXISTS "trips" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"driverId"	INTEGER NOT NULL,
+	"trackerId"	TEXT NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"endedAt"	INTEGER,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_trips_driverId_drivers_id" FOREIGN KEY("driverId") REFERENCES "drivers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_trips_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+ALTER TABLE "location_data" ADD COLUMN "driverId" INTEGER;
+PRAGMA user_version = 15;
+COMMIT;
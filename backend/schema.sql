@@ -1,27 +1,177 @@
 BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS "alarms" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"lat"	INTEGER NOT NULL,
+	"lon"	INTEGER NOT NULL,
+	"serialNumber"	INTEGER,
+	"acknowledgedBy"	INTEGER,
+	"acknowledgedAt"	INTEGER,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_alarms_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "drivers" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"name"	TEXT NOT NULL,
+	"certificate"	TEXT NOT NULL UNIQUE,
+	"agency"	TEXT NOT NULL,
+	"certificateExpiry"	TEXT NOT NULL,
+	"idNumber"	TEXT NOT NULL DEFAULT '',
+	"lastSeen"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE TABLE IF NOT EXISTS "firmware" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"model"	TEXT NOT NULL,
+	"version"	TEXT NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"manufacturerId"	TEXT NOT NULL,
+	"path"	TEXT NOT NULL,
+	"size"	INTEGER NOT NULL,
+	"uploadedAt"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_firmware_model__models_name" FOREIGN KEY("model") REFERENCES "models"("name") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "firmware_upgrades" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"firmwareId"	INTEGER NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"updatedAt"	INTEGER NOT NULL,
+	"status"	TEXT NOT NULL,
+	"sentPackages"	INTEGER NOT NULL,
+	"totalPackages"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_firmware_upgrades_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_firmware_upgrades_firmwareId_firmware_id" FOREIGN KEY("firmwareId") REFERENCES "firmware"("id") ON DELETE CASCADE
+);
 CREATE TABLE IF NOT EXISTS "jt808_authcodes" (
 	"trackerId"	TEXT NOT NULL UNIQUE,
 	"code"	TEXT NOT NULL UNIQUE,
 	PRIMARY KEY("trackerId"),
 	CONSTRAINT "jt808_authcodes_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
 );
+CREATE TABLE IF NOT EXISTS "jt808_registrations" (
+	"trackerId"	TEXT NOT NULL UNIQUE,
+	"timestamp"	INTEGER NOT NULL,
+	"provinceId"	INTEGER NOT NULL,
+	"cityId"	INTEGER NOT NULL,
+	"manufacturerId"	TEXT NOT NULL,
+	"terminalModel"	TEXT NOT NULL,
+	"terminalId"	TEXT NOT NULL,
+	"plateColour"	INTEGER NOT NULL,
+	"plateNumber"	TEXT NOT NULL,
+	PRIMARY KEY("trackerId"),
+	CONSTRAINT "fk_jt808_registrations_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
 CREATE TABLE IF NOT EXISTS "location_data" (
 	"id"	INTEGER NOT NULL UNIQUE,
 	"trackerId"	TEXT NOT NULL,
 	"timestamp"	INTEGER NOT NULL,
+	"receivedAt"	INTEGER NOT NULL DEFAULT 0,
 	"lat"	INTEGER NOT NULL,
 	"lon"	INTEGER NOT NULL,
 	"speed"	INTEGER NOT NULL,
 	"heading"	INTEGER NOT NULL,
+	"historic"	INTEGER NOT NULL DEFAULT 0,
+	"altitude"	INTEGER NOT NULL DEFAULT 0,
+	"alarmFlags"	INTEGER NOT NULL DEFAULT 0,
+	"status"	INTEGER NOT NULL DEFAULT 0,
+	"mileage"	INTEGER,
+	"fuel"	INTEGER,
+	"recorderSpeed"	INTEGER,
+	"signalStrength"	INTEGER,
+	"satellites"	INTEGER,
+	"additionalInfo"	BLOB,
+	"driverId"	INTEGER,
 	PRIMARY KEY("id" AUTOINCREMENT),
 	CONSTRAINT "fk_location_data_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
 );
+CREATE TABLE IF NOT EXISTS "media" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"mediaId"	INTEGER NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"receivedAt"	INTEGER NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"format"	INTEGER NOT NULL,
+	"event"	INTEGER NOT NULL,
+	"channel"	INTEGER NOT NULL,
+	"lat"	INTEGER NOT NULL,
+	"lon"	INTEGER NOT NULL,
+	"alarmFlags"	INTEGER NOT NULL,
+	"path"	TEXT NOT NULL,
+	"size"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_media_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
 CREATE TABLE IF NOT EXISTS "models" (
 	"name"	TEXT NOT NULL UNIQUE,
 	"init_commands"	TEXT NOT NULL,
 	"success_keywords"	TEXT NOT NULL,
 	PRIMARY KEY("name")
 );
+CREATE TABLE IF NOT EXISTS "passthrough_data" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"type"	INTEGER NOT NULL,
+	"data"	BLOB NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_passthrough_data_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "regions" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"owner"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"type"	TEXT NOT NULL,
+	"points"	TEXT NOT NULL,
+	"radius"	INTEGER NOT NULL DEFAULT 0,
+	"width"	INTEGER NOT NULL DEFAULT 0,
+	"maxSpeed"	INTEGER,
+	"overspeedDuration"	INTEGER NOT NULL DEFAULT 0,
+	"alarmOnEnter"	INTEGER NOT NULL DEFAULT 0,
+	"alarmOnExit"	INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_regions_owner__users_id" FOREIGN KEY("owner") REFERENCES "users"("id")
+);
+CREATE TABLE IF NOT EXISTS "terminal_status" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"timestamp"	INTEGER NOT NULL,
+	"oilCut"	INTEGER NOT NULL,
+	"gpsTracking"	INTEGER NOT NULL,
+	"alarm"	INTEGER NOT NULL,
+	"charging"	INTEGER NOT NULL,
+	"acc"	INTEGER NOT NULL,
+	"defense"	INTEGER NOT NULL,
+	"voltageLevel"	INTEGER NOT NULL,
+	"externalVoltage"	INTEGER NOT NULL,
+	"gsmSignal"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_terminal_status_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "tracker_regions" (
+	"trackerId"	TEXT NOT NULL,
+	"regionId"	INTEGER NOT NULL,
+	"pushedAt"	INTEGER NOT NULL,
+	PRIMARY KEY("trackerId","regionId"),
+	CONSTRAINT "fk_tracker_regions_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_tracker_regions_regionId_regions_id" FOREIGN KEY("regionId") REFERENCES "regions"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "tracking_sessions" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"trackerId"	TEXT NOT NULL,
+	"userId"	INTEGER NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"interval"	INTEGER NOT NULL,
+	"expiresAt"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_tracking_sessions_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
 CREATE TABLE IF NOT EXISTS "trackers" (
 	"id"	TEXT NOT NULL UNIQUE,
 	"name"	TEXT NOT NULL UNIQUE,
@@ -30,10 +180,22 @@ CREATE TABLE IF NOT EXISTS "trackers" (
 	"model"	TEXT NOT NULL,
 	"enabled"	INTEGER NOT NULL,
 	"lastConnected"	INTEGER NOT NULL DEFAULT 0,
+	"imsi"	TEXT NOT NULL DEFAULT '',
+	"iccid"	TEXT NOT NULL DEFAULT '',
 	PRIMARY KEY("id"),
 	CONSTRAINT "fk_trackers_model__models_name" FOREIGN KEY("model") REFERENCES "models"("name"),
 	CONSTRAINT "fk_trackers_owner__users_id" FOREIGN KEY("owner") REFERENCES "users"("id")
 );
+CREATE TABLE IF NOT EXISTS "trips" (
+	"id"	INTEGER NOT NULL UNIQUE,
+	"driverId"	INTEGER NOT NULL,
+	"trackerId"	TEXT NOT NULL,
+	"startedAt"	INTEGER NOT NULL,
+	"endedAt"	INTEGER,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	CONSTRAINT "fk_trips_driverId_drivers_id" FOREIGN KEY("driverId") REFERENCES "drivers"("id") ON DELETE CASCADE,
+	CONSTRAINT "fk_trips_trackerId_trackers_id" FOREIGN KEY("trackerId") REFERENCES "trackers"("id") ON DELETE CASCADE
+);
 CREATE TABLE IF NOT EXISTS "users" (
 	"id"	INTEGER NOT NULL UNIQUE,
 	"name"	TEXT NOT NULL UNIQUE,
@@ -47,6 +209,7 @@ INSERT INTO "models" ("name","init_commands","success_keywords") VALUES ('W18L',
  ('D21L','SERVER,0,<ip>,<port>,0#;GMT,E,0,0#;HBT,5#','OK!;OK!;OK!'),
  ('R58L','<HL&P:HOLLOO&B:<ip>:<port>&1H:300,3600>','<ip>:<port>&1H:300,3600');
 INSERT INTO "users" ("name","apikey","admin","enabled") VALUES ('Admin','AAAAAA',1,1);
+PRAGMA user_version = 15;
 COMMIT;
 
 